@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/jorbush/jorbites-notifier/config"
 	"github.com/jorbush/jorbites-notifier/internal/api"
 	"github.com/jorbush/jorbites-notifier/internal/middleware"
 	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/ratelimit"
 )
 
 func main() {
@@ -16,17 +21,79 @@ func main() {
 	log.SetOutput(os.Stdout)
 	log.Println("Starting jorbites-notifier service")
 
-	mux := http.NewServeMux()
+	keys, err := middleware.NewKeyRing(cfg)
+	if err != nil {
+		log.Fatalf("Error reading API keys: %v", err)
+	}
+	tokens, err := middleware.NewTokenVerifier(cfg)
+	if err != nil {
+		log.Fatalf("Error configuring bearer tokens: %v", err)
+	}
+	if tokens == nil {
+		log.Println("JWT_SECRET and JWT_JWKS_FILE are not set, bearer tokens are disabled")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	notificationQueue := queue.NewQueue(cfg)
+	if cfg.APIKeysFromMongo {
+		if err := keys.Watch(ctx, notificationQueue.Database().ListAPIKeys, cfg.APIKeysRefresh); err != nil {
+			log.Fatalf("Error loading API keys from MongoDB: %v", err)
+		}
+	}
+	if keys.Len() == 0 && tokens == nil {
+		log.Fatal("No credentials configured: set API_KEY, API_KEYS, API_KEYS_FROM_MONGO or JWT_SECRET/JWT_JWKS_FILE")
+	}
+	log.Printf("Accepting %d API keys", keys.Len())
+
+	var nonces middleware.NonceStore = middleware.NewMemoryNonceStore()
+	if cfg.QueueBackend != config.QueueBackendMemory {
+		nonces, err = middleware.NewMongoNonceStore(ctx, notificationQueue.Database())
+		if err != nil {
+			log.Fatalf("Error preparing the request nonce collection: %v", err)
+		}
+	}
+	auth := &middleware.Authenticator{
+		Keys:       keys,
+		Signatures: middleware.NewSignatureVerifier(keys, nonces, cfg.SignatureMaxSkew),
+		Tokens:     tokens,
+	}
+
 	notificationQueue.StartProcessing()
-	notificationHandler := api.NewNotificationHandler(notificationQueue)
+	limits, err := ratelimit.LoadLimits(cfg)
+	if err != nil {
+		log.Fatalf("Error reading notification limits: %v", err)
+	}
+	notificationHandler := api.NewNotificationHandler(notificationQueue, ratelimit.NewLimiter(limits))
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: api.NewRouter(notificationHandler, auth),
+	}
+	// Event streams never end on their own; close them so Shutdown doesn't
+	// wait for them until the deadline.
+	server.RegisterOnShutdown(notificationQueue.Events().Close)
+
+	go func() {
+		log.Printf("Starting server on port %s", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
 
-	mux.HandleFunc("/health", api.HealthCheckHandler)
-	mux.HandleFunc("/notifications", middleware.RequireAPIKey(notificationHandler.EnqueueNotification))
-	mux.HandleFunc("/queue", middleware.RequireAPIKey(notificationHandler.GetQueueStatus))
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, waiting up to %s for in-flight work", cfg.ShutdownTimeout)
 
-	log.Printf("Starting server on port %s", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, mux); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+	if err := notificationQueue.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Notification queue did not drain before the deadline: %v", err)
 	}
+	log.Println("jorbites-notifier stopped")
 }
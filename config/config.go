@@ -3,33 +3,103 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
+)
+
+const (
+	QueueBackendMongo  = "mongo"
+	QueueBackendMemory = "memory"
 )
 
 type Config struct {
-	Port            string
-	SMTPHost        string
-	SMTPPort        int
-	SMTPUser        string
-	SMTPPassword    string
-	MongoURI        string
-	MongoDB         string
-	VAPIDPublicKey  string
-	VAPIDPrivateKey string
-	VAPIDSubject    string
+	Port                  string
+	SMTPHost              string
+	SMTPPort              int
+	SMTPUser              string
+	SMTPPassword          string
+	MongoURI              string
+	MongoDB               string
+	VAPIDPublicKey        string
+	VAPIDPrivateKey       string
+	VAPIDSubject          string
+	WorkerCount           int
+	QueueBackend          string
+	QueueLeaseDuration    time.Duration
+	QueueMaxAttempts      int
+	QueueRetryBaseDelay   time.Duration
+	QueueRetryMaxDelay    time.Duration
+	QueueRetryJitter      float64
+	QueueFairShare        int
+	IdempotencyWindow     time.Duration
+	NotificationRetention time.Duration
+	ShutdownTimeout       time.Duration
+	DryRun                bool
+	WebhookURL            string
+	WebhookSecret         string
+	WebhookAllowedHosts   string
+	WebhookTimeout        time.Duration
+	WebhookMaxAttempts    int
+	WebhookRetryBaseDelay time.Duration
+	WebhookRetryMaxDelay  time.Duration
+	APIKey                string
+	APIKeys               string
+	APIKeysFromMongo      bool
+	APIKeysRefresh        time.Duration
+	SignatureMaxSkew      time.Duration
+	JWTSecret             string
+	JWTJWKSFile           string
+	JWTIssuer             string
+	JWTAudience           string
+	RateLimit             float64
+	RateLimitBurst        int
+	QueueMaxDepth         int
+	NotificationLimits    string
 }
 
 func GetConfig() *Config {
 	return &Config{
-		Port:            getEnvOrDefault("PORT", "8080"),
-		SMTPHost:        getEnvOrDefault("SMTP_HOST", "smtp.gmail.com"),
-		SMTPPort:        getEnvAsIntOrDefault("SMTP_PORT", 587),
-		SMTPUser:        os.Getenv("SMTP_USER"),
-		SMTPPassword:    os.Getenv("SMTP_PASSWORD"),
-		MongoURI:        getEnvOrDefault("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDB:         getEnvOrDefault("MONGO_DB", "jorbites"),
-		VAPIDPublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
-		VAPIDPrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
-		VAPIDSubject:    getEnvOrDefault("VAPID_SUBJECT", "mailto:test@test.com"),
+		Port:                  getEnvOrDefault("PORT", "8080"),
+		SMTPHost:              getEnvOrDefault("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:              getEnvAsIntOrDefault("SMTP_PORT", 587),
+		SMTPUser:              os.Getenv("SMTP_USER"),
+		SMTPPassword:          os.Getenv("SMTP_PASSWORD"),
+		MongoURI:              getEnvOrDefault("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:               getEnvOrDefault("MONGO_DB", "jorbites"),
+		VAPIDPublicKey:        os.Getenv("VAPID_PUBLIC_KEY"),
+		VAPIDPrivateKey:       os.Getenv("VAPID_PRIVATE_KEY"),
+		VAPIDSubject:          getEnvOrDefault("VAPID_SUBJECT", "mailto:test@test.com"),
+		WorkerCount:           getEnvAsIntOrDefault("WORKER_COUNT", 1),
+		QueueBackend:          getEnvOrDefault("QUEUE_BACKEND", QueueBackendMongo),
+		QueueLeaseDuration:    getEnvAsDurationOrDefault("QUEUE_LEASE_DURATION", 2*time.Minute),
+		QueueMaxAttempts:      getEnvAsIntOrDefault("QUEUE_MAX_ATTEMPTS", 5),
+		QueueRetryBaseDelay:   getEnvAsDurationOrDefault("QUEUE_RETRY_BASE_DELAY", 30*time.Second),
+		QueueRetryMaxDelay:    getEnvAsDurationOrDefault("QUEUE_RETRY_MAX_DELAY", 30*time.Minute),
+		QueueRetryJitter:      getEnvAsFloatOrDefault("QUEUE_RETRY_JITTER", 0.2),
+		QueueFairShare:        getEnvAsIntOrDefault("QUEUE_FAIR_SHARE", 5),
+		IdempotencyWindow:     getEnvAsDurationOrDefault("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		NotificationRetention: getEnvAsDurationOrDefault("NOTIFICATION_RETENTION", 7*24*time.Hour),
+		ShutdownTimeout:       getEnvAsDurationOrDefault("SHUTDOWN_TIMEOUT", 25*time.Second),
+		DryRun:                getEnvAsBoolOrDefault("DRY_RUN", false),
+		WebhookURL:            os.Getenv("WEBHOOK_URL"),
+		WebhookSecret:         os.Getenv("WEBHOOK_SECRET"),
+		WebhookAllowedHosts:   os.Getenv("WEBHOOK_ALLOWED_HOSTS"),
+		WebhookTimeout:        getEnvAsDurationOrDefault("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:    getEnvAsIntOrDefault("WEBHOOK_MAX_ATTEMPTS", 6),
+		WebhookRetryBaseDelay: getEnvAsDurationOrDefault("WEBHOOK_RETRY_BASE_DELAY", 5*time.Second),
+		WebhookRetryMaxDelay:  getEnvAsDurationOrDefault("WEBHOOK_RETRY_MAX_DELAY", 5*time.Minute),
+		APIKey:                os.Getenv("API_KEY"),
+		APIKeys:               os.Getenv("API_KEYS"),
+		APIKeysFromMongo:      getEnvAsBoolOrDefault("API_KEYS_FROM_MONGO", false),
+		APIKeysRefresh:        getEnvAsDurationOrDefault("API_KEYS_REFRESH", time.Minute),
+		SignatureMaxSkew:      getEnvAsDurationOrDefault("SIGNATURE_MAX_SKEW", 5*time.Minute),
+		JWTSecret:             os.Getenv("JWT_SECRET"),
+		JWTJWKSFile:           os.Getenv("JWT_JWKS_FILE"),
+		JWTIssuer:             os.Getenv("JWT_ISSUER"),
+		JWTAudience:           getEnvOrDefault("JWT_AUDIENCE", "jorbites-notifier"),
+		RateLimit:             getEnvAsFloatOrDefault("RATE_LIMIT", 10),
+		RateLimitBurst:        getEnvAsIntOrDefault("RATE_LIMIT_BURST", 100),
+		QueueMaxDepth:         getEnvAsIntOrDefault("QUEUE_MAX_DEPTH", 10000),
+		NotificationLimits:    os.Getenv("NOTIFICATION_LIMITS"),
 	}
 }
 
@@ -48,3 +118,35 @@ func getEnvAsIntOrDefault(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBoolOrDefault(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsDurationOrDefault accepts Go duration strings ("90s", "2m") as well
+// as plain integers, which are interpreted as seconds.
+func getEnvAsDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultValue
+}
@@ -4,11 +4,10 @@ go 1.22.3
 
 require (
 	github.com/SherClockHolmes/webpush-go v1.4.0
+	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.6.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
-
 require (
 	github.com/golang/snappy v1.0.0 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
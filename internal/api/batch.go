@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+const maxBatchSize = 1000
+
+type BatchItemStatus string
+
+const (
+	BatchItemEnqueued  BatchItemStatus = "enqueued"
+	BatchItemDuplicate BatchItemStatus = "duplicate"
+	BatchItemInvalid   BatchItemStatus = "invalid"
+)
+
+// BatchItemResult reports what happened to one notification of a batch, by
+// its position in the request.
+type BatchItemResult struct {
+	Index        int                        `json:"index"`
+	Status       BatchItemStatus            `json:"status"`
+	ID           string                     `json:"id,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+	Problems     []models.ValidationProblem `json:"problems,omitempty"`
+	Notification *models.Notification       `json:"notification,omitempty"`
+}
+
+// EnqueueBatch accepts an array of notifications. Every item is validated and
+// the valid ones are enqueued together; invalid items are reported without
+// affecting the rest of the batch.
+func (h *NotificationHandler) EnqueueBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	var notifications []models.Notification
+	if err := json.NewDecoder(r.Body).Decode(&notifications); err != nil {
+		if !respond.BodyTooLarge(w, r, err) {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, "Invalid batch data: "+err.Error())
+		}
+		return
+	}
+
+	if len(notifications) == 0 {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, "Batch must contain at least one notification")
+		return
+	}
+
+	if len(notifications) > maxBatchSize {
+		respond.Error(w, r, http.StatusRequestEntityTooLarge, respond.CodeBatchTooLarge, "Batch must not contain more than 1000 notifications")
+		return
+	}
+
+	results := make([]BatchItemResult, len(notifications))
+	var valid []models.Notification
+	var validIndexes []int
+	for i, notification := range notifications {
+		notification.Owner = owner(r)
+		if problems := h.validateNotification(notification); len(problems) > 0 {
+			results[i] = BatchItemResult{Index: i, Status: BatchItemInvalid, Error: "Invalid notification", Problems: problems}
+			continue
+		}
+		valid = append(valid, notification)
+		validIndexes = append(validIndexes, i)
+	}
+
+	if len(valid) > 0 && !h.admit(w, r, valid) {
+		return
+	}
+
+	if len(valid) > 0 {
+		enqueued, err := h.Queue.EnqueueBatch(valid)
+		if errors.Is(err, queue.ErrShuttingDown) {
+			respond.Error(w, r, http.StatusServiceUnavailable, respond.CodeShuttingDown, "Service is shutting down")
+			return
+		} else if err != nil {
+			log.Printf("Error enqueuing batch of %d notifications: %v", len(valid), err)
+			respond.InternalError(w, r)
+			return
+		}
+
+		for j, result := range enqueued {
+			i := validIndexes[j]
+			if result.Conflict {
+				results[i] = BatchItemResult{Index: i, Status: BatchItemInvalid, Error: "Invalid notification", Problems: []models.ValidationProblem{idempotencyConflict}}
+				continue
+			}
+			status := BatchItemEnqueued
+			if result.Duplicate {
+				status = BatchItemDuplicate
+			}
+			results[i] = BatchItemResult{
+				Index:        i,
+				Status:       status,
+				ID:           result.Notification.ID,
+				Notification: &result.Notification,
+			}
+		}
+	}
+
+	counts := map[BatchItemStatus]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"enqueued":   counts[BatchItemEnqueued],
+		"duplicates": counts[BatchItemDuplicate],
+		"invalid":    counts[BatchItemInvalid],
+		"results":    results,
+	})
+}
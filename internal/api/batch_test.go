@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// postBatch sends body to POST /v1/notifications/batch and decodes the
+// enveloped response into data.
+func postBatch(t *testing.T, router http.Handler, body string, data any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/notifications/batch", strings.NewReader(body))
+	req.Header.Set(middleware.HeaderAPIKey, testAPIKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if data != nil && rec.Code == http.StatusOK {
+		envelope := struct {
+			Data any `json:"data"`
+		}{Data: data}
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+type batchResponse struct {
+	Enqueued   int               `json:"enqueued"`
+	Duplicates int               `json:"duplicates"`
+	Invalid    int               `json:"invalid"`
+	Results    []BatchItemResult `json:"results"`
+}
+
+func TestEnqueueBatchReportsEveryItem(t *testing.T) {
+	router := newTestRouter(t)
+	like := `{"type":"NEW_LIKE","recipient":"user@example.com","metadata":{"recipeId":"65a1b2c3d4e5f6a7b8c9d0e1","likedBy":"User2"},"idempotencyKey":"batch-like"}`
+	recipe := `{"type":"NEW_RECIPE","metadata":{"recipeId":"65a1b2c3d4e5f6a7b8c9d0e1"}}`
+
+	var first batchResponse
+	if rec := postBatch(t, router, "["+like+"]", &first); rec.Code != http.StatusOK || first.Enqueued != 1 {
+		t.Fatalf("first batch = %d %s, want one enqueued", rec.Code, rec.Body.String())
+	}
+
+	var batch batchResponse
+	rec := postBatch(t, router, "["+like+`,{"type":"NEW_LIKE"},`+recipe+"]", &batch)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d %s, want 200", rec.Code, rec.Body.String())
+	}
+	if batch.Enqueued != 1 || batch.Duplicates != 1 || batch.Invalid != 1 || len(batch.Results) != 3 {
+		t.Fatalf("batch = %+v, want one enqueued, one duplicate and one invalid", batch)
+	}
+
+	duplicate, invalid, enqueued := batch.Results[0], batch.Results[1], batch.Results[2]
+	if duplicate.Index != 0 || duplicate.Status != BatchItemDuplicate || duplicate.ID != first.Results[0].ID || duplicate.Notification == nil {
+		t.Errorf("result 0 = %+v, want a duplicate of %s", duplicate, first.Results[0].ID)
+	}
+	if invalid.Index != 1 || invalid.Status != BatchItemInvalid || invalid.ID != "" || invalid.Notification != nil || len(invalid.Problems) == 0 {
+		t.Errorf("result 1 = %+v, want invalid with its problems and no notification", invalid)
+	}
+	if enqueued.Index != 2 || enqueued.Status != BatchItemEnqueued || enqueued.ID == "" ||
+		enqueued.Notification == nil || enqueued.Notification.ID != enqueued.ID || enqueued.Notification.Type != models.TypeNewRecipe {
+		t.Errorf("result 2 = %+v, want the enqueued NEW_RECIPE", enqueued)
+	}
+}
+
+func TestEnqueueBatchRejectsOversizedBatches(t *testing.T) {
+	router := newTestRouter(t)
+	items := make([]string, maxBatchSize+1)
+	for i := range items {
+		items[i] = `{"type":"NEW_RECIPE","metadata":{"recipeId":"65a1b2c3d4e5f6a7b8c9d0e1"}}`
+	}
+
+	rec := postBatch(t, router, "["+strings.Join(items, ",")+"]", nil)
+	var problem respond.Problem
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	if rec.Code != http.StatusRequestEntityTooLarge || problem.Code != respond.CodeBatchTooLarge {
+		t.Errorf("batch of %d = %d %s, want 413 %s", len(items), rec.Code, problem.Code, respond.CodeBatchTooLarge)
+	}
+
+	var page struct {
+		Data struct {
+			Summary struct {
+				Total int `json:"total"`
+			} `json:"summary"`
+		} `json:"data"`
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/queue", nil)
+	req.Header.Set(middleware.HeaderAPIKey, testAPIKey)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /v1/queue = %d %s", rec.Code, rec.Body.String())
+	}
+	if page.Data.Summary.Total != 0 {
+		t.Errorf("queue holds %d notifications after an oversized batch, want none", page.Data.Summary.Total)
+	}
+}
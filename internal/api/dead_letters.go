@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// DeadLetters lists (GET) or purges (DELETE) every dead letter.
+func (h *NotificationHandler) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		deadLetters, err := h.Queue.ListDeadLetters()
+		if err != nil {
+			log.Printf("Error listing dead letters: %v", err)
+			respond.InternalError(w, r)
+			return
+		}
+		respond.JSON(w, r, http.StatusOK, map[string]any{
+			"count":       len(deadLetters),
+			"deadLetters": deadLetters,
+		})
+	case http.MethodDelete:
+		purged, err := h.Queue.PurgeDeadLetters()
+		if err != nil {
+			log.Printf("Error purging dead letters: %v", err)
+			respond.InternalError(w, r)
+			return
+		}
+		respond.JSON(w, r, http.StatusOK, map[string]any{
+			"purged": purged,
+		})
+	default:
+		respond.MethodNotAllowed(w, r)
+	}
+}
+
+// DeadLetter purges a single dead letter.
+func (h *NotificationHandler) DeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.Queue.PurgeDeadLetter(id); err != nil {
+		if errors.Is(err, queue.ErrNotFound) {
+			respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Dead letter not found")
+			return
+		}
+		log.Printf("Error purging dead letter %s: %v", id, err)
+		respond.InternalError(w, r)
+		return
+	}
+
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"purged": 1,
+	})
+}
+
+// ReplayDeadLetters puts every dead letter back into the queue.
+func (h *NotificationHandler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	notifications, err := h.Queue.ReplayDeadLetters()
+	if err != nil {
+		log.Printf("Error replaying dead letters (%d replayed): %v", len(notifications), err)
+		respond.InternalError(w, r)
+		return
+	}
+
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"count":         len(notifications),
+		"notifications": notifications,
+	})
+}
+
+// ReplayDeadLetter puts a single dead letter back into the queue.
+func (h *NotificationHandler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	notification, err := h.Queue.ReplayDeadLetter(id)
+	if err != nil {
+		if errors.Is(err, queue.ErrNotFound) {
+			respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Dead letter not found")
+			return
+		}
+		log.Printf("Error replaying dead letter %s: %v", id, err)
+		respond.InternalError(w, r)
+		return
+	}
+
+	respond.JSON(w, r, http.StatusCreated, notification)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+const eventStreamHeartbeat = 15 * time.Second
+
+// QueueEvents streams queue events as Server-Sent Events. The type query
+// parameter, repeated or comma-separated, limits the stream to the given
+// notification types.
+func (h *NotificationHandler) QueueEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond.Error(w, r, http.StatusInternalServerError, respond.CodeInternal, "Streaming not supported")
+		return
+	}
+
+	types, err := notificationTypesParam(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	events, unsubscribe := h.Queue.Events().Subscribe(types)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding queue event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
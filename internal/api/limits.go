@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// queueFullRetryAfter is suggested to clients when the queue is full; how
+// soon it drains depends on the delivery backlog, not on the client.
+const queueFullRetryAfter = 30 * time.Second
+
+// admit applies the queue depth limits and the client's rate limits to
+// notifications about to be enqueued. When a limit is exceeded it answers
+// 429 with Retry-After and returns false; nothing is enqueued or charged.
+// The notifications of the request count toward the depth limits, so a batch
+// that would take the queue past them is refused as a whole.
+func (h *NotificationHandler) admit(w http.ResponseWriter, r *http.Request, notifications []models.Notification) bool {
+	if h.Limiter == nil {
+		return true
+	}
+	limits := h.Limiter.Limits
+
+	counts := map[models.NotificationType]int{}
+	for _, notification := range notifications {
+		counts[notification.Type]++
+	}
+
+	// If the queue can't be counted, enqueuing is likely to fail as well and
+	// will report the error; don't turn it into a 429.
+	depth, err := h.Queue.Depth()
+	if err != nil {
+		log.Printf("Error counting queue depth: %v", err)
+	} else {
+		if limits.MaxDepth > 0 && depth.Total+len(notifications) > limits.MaxDepth {
+			tooManyRequests(w, r, queueFullRetryAfter, respond.CodeQueueFull,
+				fmt.Sprintf("Queue is full: %d notifications are waiting", depth.Total))
+			return false
+		}
+		for notificationType := range counts {
+			limit := limits.For(notificationType)
+			if limit.MaxDepth > 0 && depth.ByType[notificationType]+counts[notificationType] > limit.MaxDepth {
+				tooManyRequests(w, r, queueFullRetryAfter, respond.CodeQueueFull,
+					fmt.Sprintf("Queue is full: %d %s notifications are waiting", depth.ByType[notificationType], notificationType))
+				return false
+			}
+		}
+	}
+
+	client := clientID(r)
+	if wait, ok := h.Limiter.Take(client, counts); !ok {
+		log.Printf("%s %s rate limited for %s", r.Method, r.URL.Path, client)
+		tooManyRequests(w, r, wait, respond.CodeRateLimited, "Too many notifications, retry later")
+		return false
+	}
+	return true
+}
+
+// clientID names the client rate limits apply to: its API key, or its IP
+// address for requests without one.
+func clientID(r *http.Request) string {
+	if key, ok := middleware.APIKeyFrom(r.Context()); ok {
+		return "key " + key.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "IP " + host
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, code string, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	respond.Error(w, r, http.StatusTooManyRequests, code, message)
+}
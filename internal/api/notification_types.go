@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jorbush/jorbites-notifier/internal/i18n"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// NotificationTypeInfo describes a supported notification type, built from its
+// schema so the catalog can't drift from what the API accepts.
+type NotificationTypeInfo struct {
+	models.NotificationSchema
+	Priority        models.Priority `json:"defaultPriority"`
+	Languages       []string        `json:"languages"`
+	DefaultLanguage string          `json:"defaultLanguage"`
+	Example         ExamplePayload  `json:"example"`
+}
+
+// ExamplePayload is a valid POST /notifications request body.
+type ExamplePayload struct {
+	Type      models.NotificationType `json:"type"`
+	Recipient string                  `json:"recipient,omitempty"`
+	Metadata  map[string]string       `json:"metadata,omitempty"`
+}
+
+// NotificationTypeCatalog returns every supported notification type.
+func NotificationTypeCatalog() []NotificationTypeInfo {
+	catalog := make([]NotificationTypeInfo, 0, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		schema, ok := models.SchemaFor(notificationType)
+		if !ok {
+			continue
+		}
+		example := schema.Example()
+		catalog = append(catalog, NotificationTypeInfo{
+			NotificationSchema: schema,
+			Priority:           models.DefaultPriority(notificationType),
+			Languages:          i18n.SupportedLanguages(notificationType),
+			DefaultLanguage:    defaultLanguage,
+			Example: ExamplePayload{
+				Type:      example.Type,
+				Recipient: example.Recipient,
+				Metadata:  example.Metadata,
+			},
+		})
+	}
+	return catalog
+}
+
+// NotificationTypes lists the supported notification types with their
+// metadata, channels, audience and an example payload.
+func NotificationTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	catalog := NotificationTypeCatalog()
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"count": len(catalog),
+		"types": catalog,
+	})
+}
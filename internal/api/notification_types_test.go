@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+type catalogField struct {
+	Key    string                `json:"key"`
+	Format models.MetadataFormat `json:"format"`
+}
+
+func fieldKeys(fields []catalogField) []string {
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		keys[i] = field.Key
+	}
+	return keys
+}
+
+func schemaKeys(fields []models.MetadataField) []string {
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		keys[i] = field.Key
+	}
+	return keys
+}
+
+func TestNotificationTypesListsMetadata(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRouter(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/notification-types", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /v1/notification-types = %d %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Data struct {
+			Count int `json:"count"`
+			Types []struct {
+				Type              models.NotificationType `json:"type"`
+				RecipientRequired bool                    `json:"recipientRequired"`
+				Required          []catalogField          `json:"requiredMetadata"`
+				Optional          []catalogField          `json:"optionalMetadata"`
+				Example           models.Notification     `json:"example"`
+			} `json:"types"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+	}
+	if body.Data.Count != len(models.NotificationTypes) || len(body.Data.Types) != body.Data.Count {
+		t.Fatalf("catalog lists %d types with count %d, want %d", len(body.Data.Types), body.Data.Count, len(models.NotificationTypes))
+	}
+
+	for i, info := range body.Data.Types {
+		if info.Type != models.NotificationTypes[i] {
+			t.Errorf("type %d = %s, want %s", i, info.Type, models.NotificationTypes[i])
+			continue
+		}
+		schema, _ := models.SchemaFor(info.Type)
+		if info.RecipientRequired != schema.RecipientRequired {
+			t.Errorf("%s recipientRequired = %t, want %t", info.Type, info.RecipientRequired, schema.RecipientRequired)
+		}
+		if got, want := fieldKeys(info.Required), schemaKeys(schema.Required); !slices.Equal(got, want) {
+			t.Errorf("%s requiredMetadata = %v, want %v", info.Type, got, want)
+		}
+		if got, want := fieldKeys(info.Optional), schemaKeys(schema.Optional); !slices.Equal(got, want) {
+			t.Errorf("%s optionalMetadata = %v, want %v", info.Type, got, want)
+		}
+		for _, field := range append(info.Required, info.Optional...) {
+			if field.Format == "" {
+				t.Errorf("%s metadata %s has no format", info.Type, field.Key)
+			}
+		}
+		if problems := schema.Validate(info.Example); len(problems) > 0 {
+			t.Errorf("%s example is invalid: %+v", info.Type, problems)
+		}
+	}
+
+	// Spot check one type against its documentation.
+	for _, info := range body.Data.Types {
+		if info.Type == models.TypeNewRecipe {
+			if !slices.Equal(fieldKeys(info.Required), []string{"recipeId"}) || !slices.Equal(fieldKeys(info.Optional), []string{"recipeName", "slug"}) {
+				t.Errorf("NEW_RECIPE metadata = %v and %v, want recipeId required and recipeName, slug optional", fieldKeys(info.Required), fieldKeys(info.Optional))
+			}
+		}
+	}
+}
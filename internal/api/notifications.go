@@ -2,71 +2,297 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
 	"github.com/jorbush/jorbites-notifier/internal/models"
 	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/ratelimit"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
 )
 
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// idempotencyConflict reports an idempotency key reused for a different
+// notification.
+var idempotencyConflict = models.ValidationProblem{Field: "idempotencyKey", Message: "was already used for a different notification"}
+
+// owner names the API key a request was authenticated with, which the
+// idempotency keys it sends are scoped to.
+func owner(r *http.Request) string {
+	key, _ := middleware.APIKeyFrom(r.Context())
+	return key.Name
+}
+
+// validateNotification checks the fields a client may set on a notification
+// and its metadata against the schema of its type, returning every problem.
+func (h *NotificationHandler) validateNotification(notification models.Notification) []models.ValidationProblem {
+	var problems []models.ValidationProblem
+
+	if len(notification.IdempotencyKey) > maxIdempotencyKeyLen {
+		problems = append(problems, models.ValidationProblem{Field: "idempotencyKey", Message: "is too long"})
+	}
+
+	if notification.DelaySeconds < 0 {
+		problems = append(problems, models.ValidationProblem{Field: "delaySeconds", Message: "must not be negative"})
+	}
+
+	if notification.DelaySeconds > 0 && notification.SendAt != nil {
+		problems = append(problems, models.ValidationProblem{Field: "sendAt", Message: "only one of sendAt and delaySeconds can be set"})
+	}
+
+	if notification.CallbackURL != "" {
+		if err := models.FormatURL.Check(notification.CallbackURL); err != nil {
+			problems = append(problems, models.ValidationProblem{Field: "callbackUrl", Message: err.Error()})
+		} else if !h.Queue.CallbackAllowed(notification.CallbackURL) {
+			problems = append(problems, models.ValidationProblem{Field: "callbackUrl", Message: "must be on a host allowed to receive callbacks"})
+		}
+	}
+
+	if notification.Type == "" {
+		return append(problems, models.ValidationProblem{Field: "type", Message: "is required"})
+	}
+
+	schema, ok := models.SchemaFor(notification.Type)
+	if !ok {
+		return append(problems, models.ValidationProblem{Field: "type", Message: "unknown notification type " + string(notification.Type)})
+	}
+
+	return append(problems, schema.Validate(notification)...)
+}
+
 type NotificationHandler struct {
 	Queue *queue.Queue
+	// Limiter applies rate and queue depth limits to enqueued notifications;
+	// nil disables them.
+	Limiter *ratelimit.Limiter
 }
 
-func NewNotificationHandler(q *queue.Queue) *NotificationHandler {
+func NewNotificationHandler(q *queue.Queue, limiter *ratelimit.Limiter) *NotificationHandler {
 	return &NotificationHandler{
-		Queue: q,
+		Queue:   q,
+		Limiter: limiter,
 	}
 }
 
 func (h *NotificationHandler) EnqueueNotification(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respond.MethodNotAllowed(w, r)
 		return
 	}
 
 	var notification models.Notification
 	err := json.NewDecoder(r.Body).Decode(&notification)
 	if err != nil {
-		http.Error(w, "Invalid notification data: "+err.Error(), http.StatusBadRequest)
+		if !respond.BodyTooLarge(w, r, err) {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, "Invalid notification data: "+err.Error())
+		}
 		return
 	}
 
-	if notification.Type == "" {
-		http.Error(w, "Type is required", http.StatusBadRequest)
+	if key := r.Header.Get(HeaderIdempotencyKey); key != "" {
+		if notification.IdempotencyKey != "" && notification.IdempotencyKey != key {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, "Idempotency-Key header and idempotencyKey field differ")
+			return
+		}
+		notification.IdempotencyKey = key
+	}
+	notification.Owner = owner(r)
+
+	if problems := h.validateNotification(notification); len(problems) > 0 {
+		respond.ValidationProblems(w, r, problems)
 		return
 	}
 
-	h.Queue.Enqueue(notification)
+	if !h.admit(w, r, []models.Notification{notification}) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(notification)
-	if err != nil {
-		log.Printf("Error encoding notification: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	status := http.StatusCreated
+	notification, err = h.Queue.Enqueue(notification)
+	if errors.Is(err, queue.ErrDuplicate) {
+		w.Header().Set("Idempotent-Replayed", "true")
+		status = http.StatusOK
+	} else if errors.Is(err, queue.ErrIdempotencyConflict) {
+		respond.Error(w, r, http.StatusUnprocessableEntity, respond.CodeIdempotencyConflict, "Idempotency key "+idempotencyConflict.Message)
+		return
+	} else if errors.Is(err, queue.ErrShuttingDown) {
+		respond.Error(w, r, http.StatusServiceUnavailable, respond.CodeShuttingDown, "Service is shutting down")
+		return
+	} else if err != nil {
+		log.Printf("Error enqueuing notification: %v", err)
+		respond.InternalError(w, r)
 		return
 	}
+
+	respond.JSON(w, r, status, notification)
 }
 
+// GetQueueStatus lists a page of the queue, filtered by the query parameters,
+// with a summary of every notification matching the filters.
 func (h *NotificationHandler) GetQueueStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	filter, err := queueFilter(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	page, err := h.Queue.GetQueueStatus(filter)
+	if err != nil {
+		log.Printf("Error fetching queue status: %v", err)
+		respond.InternalError(w, r)
 		return
 	}
 
-	count, notifications := h.Queue.GetQueueStatus()
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"count":         page.Summary.Total,
+		"notifications": page.Notifications,
+		"nextCursor":    page.NextCursor,
+		"summary":       page.Summary,
+	})
+}
+
+// queueFilter reads the filters and paging of GET /queue. Ages are durations
+// such as 30s or 2h measured from now.
+func queueFilter(r *http.Request) (queue.ListFilter, error) {
+	query := r.URL.Query()
+	filter := queue.ListFilter{Recipient: strings.TrimSpace(query.Get("recipient"))}
+
+	var err error
+	if filter.Types, err = notificationTypesParam(r); err != nil {
+		return filter, err
+	}
+
+	for _, s := range listParam(r, "status") {
+		status := models.NotificationStatus(s)
+		if status != models.StatusPending && status != models.StatusProcessing && !status.Terminal() {
+			return filter, fmt.Errorf("unknown status: %s", s)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > queue.MaxListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", queue.MaxListLimit)
+		}
+	}
 
-	response := map[string]any{
-		"count":         count,
-		"notifications": notifications,
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := queue.DecodeCursor(cursor)
+		if err != nil {
+			return filter, queue.ErrInvalidCursor
+		}
+		filter.After = &after
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(response)
+	now := time.Now().UTC()
+	if filter.CreatedBefore, err = ageParam(query.Get("olderThan"), now); err != nil {
+		return filter, fmt.Errorf("olderThan %w", err)
+	}
+	if filter.CreatedAfter, err = ageParam(query.Get("newerThan"), now); err != nil {
+		return filter, fmt.Errorf("newerThan %w", err)
+	}
+	return filter, nil
+}
+
+func ageParam(value string, now time.Time) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return nil, fmt.Errorf("must be a positive duration such as 30m, got %q", value)
+	}
+	t := now.Add(-age)
+	return &t, nil
+}
+
+// notificationTypesParam reads the type query parameter and rejects unknown
+// types.
+func notificationTypesParam(r *http.Request) ([]models.NotificationType, error) {
+	var types []models.NotificationType
+	for _, t := range listParam(r, "type") {
+		if _, ok := models.SchemaFor(models.NotificationType(t)); !ok {
+			return nil, fmt.Errorf("unknown notification type: %s", t)
+		}
+		types = append(types, models.NotificationType(t))
+	}
+	return types, nil
+}
+
+// listParam returns the values of a query parameter that may be repeated or
+// comma-separated.
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, param := range r.URL.Query()[name] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// Notification returns a notification with its status, lifecycle history and
+// per-channel delivery results (GET), or cancels it while pending (DELETE).
+func (h *NotificationHandler) Notification(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getNotification(w, r)
+	case http.MethodDelete:
+		h.cancelNotification(w, r)
+	default:
+		respond.MethodNotAllowed(w, r)
+	}
+}
+
+func (h *NotificationHandler) getNotification(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	notification, err := h.Queue.GetNotification(id)
+	if err != nil {
+		if errors.Is(err, queue.ErrNotFound) {
+			respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Notification not found")
+			return
+		}
+		log.Printf("Error fetching notification %s: %v", id, err)
+		respond.InternalError(w, r)
+		return
+	}
+
+	respond.JSON(w, r, http.StatusOK, notification)
+}
+
+func (h *NotificationHandler) cancelNotification(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	notification, err := h.Queue.CancelNotification(id)
 	if err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Notification not found")
+		case errors.Is(err, queue.ErrNotPending):
+			respond.Error(w, r, http.StatusConflict, respond.CodeNotPending, fmt.Sprintf("Notification can't be cancelled: it is already %s", notification.Status))
+		default:
+			log.Printf("Error cancelling notification %s: %v", id, err)
+			respond.InternalError(w, r)
+		}
 		return
 	}
+
+	respond.JSON(w, r, http.StatusOK, notification)
 }
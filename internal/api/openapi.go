@@ -0,0 +1,599 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// OpenAPIVersion is the version of the API described by the specification.
+const OpenAPIVersion = "1.0.0"
+
+// OpenAPIHandler serves the OpenAPI 3 specification of the /v1 API. It is
+// served as is, without the response envelope.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPIDocument()); err != nil {
+		log.Printf("Error writing OpenAPI document: %v", err)
+	}
+}
+
+var openAPIDocument = sync.OnceValue(func() []byte {
+	document, err := json.MarshalIndent(OpenAPI(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return document
+})
+
+// OpenAPI builds the OpenAPI 3 specification of the /v1 API. Notification
+// request bodies and metadata are generated from the notification schemas,
+// so they always match what the API accepts.
+func OpenAPI() map[string]any {
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Jorbites Notifier API",
+			"version":     OpenAPIVersion,
+			"description": "Queues and delivers Jorbites email and push notifications. Successful responses are wrapped in an envelope; errors are RFC 7807 problems with a machine-readable code.",
+		},
+		"servers":    []any{map[string]any{"url": "/v1"}},
+		"security":   []any{map[string]any{"ApiKeyAuth": []any{}}, map[string]any{"RequestSignature": []any{}}, map[string]any{"BearerAuth": []any{}}},
+		"paths":      openAPIPaths(),
+		"components": openAPIComponents(),
+	}
+}
+
+func openAPIPaths() map[string]any {
+	return map[string]any{
+		"/health": map[string]any{
+			"get": operation("getHealth", "Health check", public, nil,
+				ok("The service is up", ref("Health"))),
+		},
+		"/openapi.json": map[string]any{
+			"get": operation("getOpenAPI", "This OpenAPI document, without the response envelope", public, nil,
+				responses{"200": map[string]any{
+					"description": "The OpenAPI document",
+					"content":     jsonContent(map[string]any{"type": "object"}),
+				}}),
+		},
+		"/notification-types": map[string]any{
+			"get": operation("listNotificationTypes", "List the supported notification types", public, nil,
+				ok("The notification type catalog", ref("NotificationTypeCatalog"))),
+		},
+		"/notifications": map[string]any{
+			"post": withBody(scoped(models.ScopeNotificationsWrite, operation("enqueueNotification", "Add a notification to the queue", nil,
+				[]any{headerParam(HeaderIdempotencyKey, "Deduplicates retried requests; same as the idempotencyKey field")},
+				merge(
+					responses{
+						"201": envelopeResponse("The notification was enqueued", ref("Notification")),
+						"200": envelopeResponse("The idempotency key was already used; returns the notification originally created for it", ref("Notification")),
+					},
+					problems("400", "401", "413", "422", "429", "503"),
+				))), ref("NotificationRequest")),
+		},
+		"/notifications/batch": map[string]any{
+			"post": withBody(scoped(models.ScopeNotificationsWrite, operation("enqueueBatch", "Add up to 1000 notifications to the queue at once", nil, nil,
+				merge(ok("Per-item results; invalid items don't affect the rest of the batch", ref("BatchResponse")),
+					problems("400", "401", "413", "429", "503")))),
+				arrayOf(ref("NotificationRequest"))),
+		},
+		"/notifications/{id}": map[string]any{
+			"parameters": []any{pathParam("id", "ID of the notification")},
+			"get": scoped(models.ScopeNotificationsRead, operation("getNotification", "Get a notification with its lifecycle and delivery results", nil, nil,
+				merge(ok("The notification", ref("Notification")), problems("401", "404")))),
+			"delete": scoped(models.ScopeNotificationsWrite, operation("cancelNotification", "Cancel a pending notification", nil, nil,
+				merge(ok("The cancelled notification", ref("Notification")), problems("401", "404", "409")))),
+		},
+		"/preview": map[string]any{
+			"post": withBody(scoped(models.ScopeNotificationsWrite, operation("previewNotification", "Render the email and push content of a notification without sending it", nil, nil,
+				merge(ok("The rendered content", ref("PreviewResponse")), problems("400", "401", "413", "422")))),
+				ref("PreviewRequest")),
+		},
+		"/queue": map[string]any{
+			"get": scoped(models.ScopeQueueRead, operation("getQueue", "List and summarize the queue", nil, []any{
+				queryParam("limit", "Page size", map[string]any{"type": "integer", "minimum": 1, "maximum": queue.MaxListLimit, "default": queue.DefaultListLimit}),
+				queryParam("cursor", "The nextCursor of the previous page", map[string]any{"type": "string"}),
+				listQueryParam("type", "Only these notification types", ref("NotificationType")),
+				listQueryParam("status", "Only these statuses; defaults to pending and processing", ref("NotificationStatus")),
+				queryParam("recipient", "Only notifications for this recipient email", map[string]any{"type": "string"}),
+				queryParam("olderThan", "Only notifications enqueued more than this long ago, e.g. 10m", map[string]any{"type": "string"}),
+				queryParam("newerThan", "Only notifications enqueued less than this long ago", map[string]any{"type": "string"}),
+			}, merge(ok("A page of the queue and a summary of every matching notification", ref("QueuePage")), problems("400", "401")))),
+		},
+		"/queue/events": map[string]any{
+			"get": scoped(models.ScopeQueueRead, operation("streamQueueEvents", "Stream queue events as Server-Sent Events", nil, []any{
+				listQueryParam("type", "Only events of these notification types", ref("NotificationType")),
+			}, merge(responses{"200": map[string]any{
+				"description": "An event stream. The data of each event is a QueueEvent; events are not wrapped in the envelope.",
+				"content": map[string]any{
+					"text/event-stream": map[string]any{"schema": ref("QueueEvent")},
+				},
+			}}, problems("400", "401")))),
+		},
+		"/queue/dead-letters": map[string]any{
+			"get": scoped(models.ScopeQueueRead, operation("listDeadLetters", "List dead letters", nil, nil,
+				merge(ok("Every dead letter", ref("DeadLetterList")), problems("401")))),
+			"delete": scoped(models.ScopeAdmin, operation("purgeDeadLetters", "Purge every dead letter", nil, nil,
+				merge(ok("How many dead letters were purged", ref("PurgeResult")), problems("401")))),
+		},
+		"/queue/dead-letters/replay": map[string]any{
+			"post": scoped(models.ScopeAdmin, operation("replayDeadLetters", "Put every dead letter back into the queue", nil, nil,
+				merge(ok("The re-enqueued notifications", ref("ReplayResult")), problems("401")))),
+		},
+		"/queue/dead-letters/{id}": map[string]any{
+			"parameters": []any{pathParam("id", "ID of the dead letter")},
+			"delete": scoped(models.ScopeAdmin, operation("purgeDeadLetter", "Purge a dead letter", nil, nil,
+				merge(ok("The dead letter was purged", ref("PurgeResult")), problems("401", "404")))),
+		},
+		"/queue/dead-letters/{id}/replay": map[string]any{
+			"parameters": []any{pathParam("id", "ID of the dead letter")},
+			"post": scoped(models.ScopeAdmin, operation("replayDeadLetter", "Put a dead letter back into the queue", nil, nil,
+				merge(responses{"201": envelopeResponse("The re-enqueued notification", ref("Notification"))}, problems("401", "404")))),
+		},
+	}
+}
+
+type responses = map[string]any
+
+// public clears the API key requirement of an operation.
+var public = []any{}
+
+func operation(id string, summary string, security []any, parameters []any, responses responses) map[string]any {
+	op := map[string]any{
+		"operationId": id,
+		"summary":     summary,
+		"responses":   responses,
+	}
+	if security != nil {
+		op["security"] = security
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	return op
+}
+
+// scoped documents the API key scope an operation requires, in its
+// description and the x-scope extension.
+func scoped(scope models.Scope, op map[string]any) map[string]any {
+	op["description"] = "Requires an API key with the " + string(scope) + " scope."
+	op["x-scope"] = scope
+	op["responses"] = merge(op["responses"].(responses), problems("403"))
+	return op
+}
+
+func withBody(op map[string]any, schema map[string]any) map[string]any {
+	op["requestBody"] = map[string]any{
+		"required": true,
+		"content":  jsonContent(schema),
+	}
+	return op
+}
+
+func ok(description string, data map[string]any) responses {
+	return responses{"200": envelopeResponse(description, data)}
+}
+
+func envelopeResponse(description string, data map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": jsonContent(object([]string{"success", "data"}, map[string]any{
+			"success": map[string]any{"type": "boolean", "enum": []any{true}},
+			"data":    data,
+		})),
+	}
+}
+
+var problemDescriptions = map[string]string{
+	"400": "The request is malformed",
+	"401": "The API key, request signature or bearer token is missing, invalid or expired",
+	"403": "The API key lacks the scope the operation requires",
+	"404": "Not found",
+	"409": "The notification is no longer pending",
+	"413": "The request body or the batch is too large",
+	"422": "The notification is invalid, can't be rendered, or reuses an idempotency key for a different notification",
+	"429": "The client's rate limit or the queue depth limit was reached; retry after the Retry-After header",
+	"503": "The service is shutting down",
+}
+
+// problems documents error responses; every operation may also answer 500.
+func problems(statuses ...string) responses {
+	r := responses{"500": problemResponse("Unexpected server error")}
+	for _, status := range statuses {
+		r[status] = problemResponse(problemDescriptions[status])
+	}
+	return r
+}
+
+func problemResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			respond.ContentTypeProblem: map[string]any{"schema": ref("Problem")},
+		},
+	}
+}
+
+func merge(all ...responses) responses {
+	merged := responses{}
+	for _, r := range all {
+		for status, response := range r {
+			merged[status] = response
+		}
+	}
+	return merged
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func pathParam(name string, description string) map[string]any {
+	return map[string]any{"name": name, "in": "path", "required": true, "description": description, "schema": map[string]any{"type": "string"}}
+}
+
+func queryParam(name string, description string, schema map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+// listQueryParam documents a parameter that may be repeated or comma-separated.
+func listQueryParam(name string, description string, items map[string]any) map[string]any {
+	param := queryParam(name, description+". Repeated or comma-separated", arrayOf(items))
+	param["style"] = "form"
+	param["explode"] = true
+	return param
+}
+
+func headerParam(name string, description string) map[string]any {
+	return map[string]any{"name": name, "in": "header", "description": description, "schema": map[string]any{"type": "string", "maxLength": maxIdempotencyKeyLen}}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func object(required []string, properties map[string]any) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+func mapOf(values map[string]any) map[string]any {
+	return map[string]any{"type": "object", "additionalProperties": values}
+}
+
+func stringEnum[T ~string](values ...T) map[string]any {
+	enum := make([]any, len(values))
+	for i, v := range values {
+		enum[i] = string(v)
+	}
+	return map[string]any{"type": "string", "enum": enum}
+}
+
+func nullable(schema map[string]any) map[string]any {
+	if _, isRef := schema["$ref"]; isRef {
+		return map[string]any{"allOf": []any{schema}, "nullable": true}
+	}
+	schema["nullable"] = true
+	return schema
+}
+
+var (
+	stringSchema   = map[string]any{"type": "string"}
+	dateTimeSchema = map[string]any{"type": "string", "format": "date-time"}
+	integerSchema  = map[string]any{"type": "integer"}
+	booleanSchema  = map[string]any{"type": "boolean"}
+)
+
+func openAPIComponents() map[string]any {
+	schemas := map[string]any{
+		"NotificationType": stringEnum(models.NotificationTypes...),
+		"NotificationStatus": stringEnum(models.StatusPending, models.StatusProcessing, models.StatusSent,
+			models.StatusPartiallySent, models.StatusFailed, models.StatusCancelled, models.StatusDryRun),
+		"Priority": stringEnum(models.PriorityLow.String(), models.PriorityNormal.String(), models.PriorityHigh.String()),
+		"Health":   object([]string{"status"}, map[string]any{"status": stringSchema}),
+		"Problem": object([]string{"type", "title", "status", "code"}, map[string]any{
+			"type":     map[string]any{"type": "string", "format": "uri", "description": "Link to the documentation of the code"},
+			"title":    stringSchema,
+			"status":   integerSchema,
+			"detail":   stringSchema,
+			"instance": stringSchema,
+			"code": stringEnum(respond.CodeInvalidRequest, respond.CodeValidationFailed, respond.CodeMissingAPIKey,
+				respond.CodeInvalidAPIKey, respond.CodeExpiredAPIKey, respond.CodeInsufficientScope,
+				respond.CodeInvalidSignature, respond.CodeReplayedRequest, respond.CodeInvalidToken, respond.CodeNotFound,
+				respond.CodeMethodNotAllowed, respond.CodeNotPending, respond.CodeBatchTooLarge, respond.CodeBodyTooLarge,
+				respond.CodeRenderFailed, respond.CodeIdempotencyConflict, respond.CodeRateLimited, respond.CodeQueueFull, respond.CodeShuttingDown,
+				respond.CodeInternal),
+			"problems": arrayOf(ref("ValidationProblem")),
+		}),
+		"ValidationProblem": object([]string{"field", "message"}, map[string]any{
+			"field":   stringSchema,
+			"message": stringSchema,
+		}),
+		"NotificationRequest": notificationRequestSchema(),
+		"Notification": object([]string{"type", "status", "createdAt", "updatedAt", "attempts"}, map[string]any{
+			"id":             stringSchema,
+			"type":           ref("NotificationType"),
+			"status":         ref("NotificationStatus"),
+			"recipient":      stringSchema,
+			"metadata":       mapOf(stringSchema),
+			"priority":       ref("Priority"),
+			"createdAt":      dateTimeSchema,
+			"updatedAt":      dateTimeSchema,
+			"idempotencyKey": stringSchema,
+			"sendAt":         dateTimeSchema,
+			"dryRun":         booleanSchema,
+			"callbackUrl":    stringSchema,
+			"attempts":       integerSchema,
+			"nextAttemptAt":  dateTimeSchema,
+			"lastError":      stringSchema,
+			"history":        arrayOf(ref("Attempt")),
+			"lifecycle":      arrayOf(ref("StatusChange")),
+			"delivery":       ref("DeliveryReport"),
+			"completedAt":    dateTimeSchema,
+			"leaseOwner":     stringSchema,
+			"leaseExpiresAt": dateTimeSchema,
+		}),
+		"Attempt": object([]string{"number", "startedAt", "finishedAt"}, map[string]any{
+			"number":      integerSchema,
+			"startedAt":   dateTimeSchema,
+			"finishedAt":  dateTimeSchema,
+			"error":       stringSchema,
+			"interrupted": booleanSchema,
+		}),
+		"StatusChange": object([]string{"status", "at"}, map[string]any{
+			"status": ref("NotificationStatus"),
+			"at":     dateTimeSchema,
+			"detail": stringSchema,
+		}),
+		"DeliveryReport": object([]string{"email", "push", "results"}, map[string]any{
+			"email":   ref("ChannelSummary"),
+			"push":    ref("ChannelSummary"),
+			"results": nullable(arrayOf(ref("DeliveryResult"))),
+		}),
+		"ChannelSummary": object([]string{"sent", "failed", "skipped"}, map[string]any{
+			"sent":    integerSchema,
+			"failed":  integerSchema,
+			"skipped": integerSchema,
+			"dryRun":  integerSchema,
+		}),
+		"DeliveryResult": object([]string{"channel", "status", "at"}, map[string]any{
+			"channel":        stringEnum(models.ChannelEmail, models.ChannelPush),
+			"status":         stringEnum(models.DeliverySent, models.DeliveryFailed, models.DeliverySkipped, models.DeliveryDryRun),
+			"recipient":      stringSchema,
+			"userId":         stringSchema,
+			"subscriptionId": stringSchema,
+			"language":       stringSchema,
+			"title":          stringSchema,
+			"error":          stringSchema,
+			"at":             dateTimeSchema,
+		}),
+		"DeadLetter": object([]string{"id", "notification", "reason", "lastError", "attempts", "failedAt"}, map[string]any{
+			"id":           stringSchema,
+			"notification": ref("Notification"),
+			"reason":       stringEnum(models.DeadLetterRetriesExhausted, models.DeadLetterPermanentFailure),
+			"lastError":    stringSchema,
+			"attempts":     arrayOf(ref("Attempt")),
+			"failedAt":     dateTimeSchema,
+		}),
+		"DeadLetterList": object([]string{"count", "deadLetters"}, map[string]any{
+			"count":       integerSchema,
+			"deadLetters": arrayOf(ref("DeadLetter")),
+		}),
+		"PurgeResult": object([]string{"purged"}, map[string]any{"purged": integerSchema}),
+		"ReplayResult": object([]string{"count", "notifications"}, map[string]any{
+			"count":         integerSchema,
+			"notifications": arrayOf(ref("Notification")),
+		}),
+		"BatchResponse": object([]string{"enqueued", "duplicates", "invalid", "results"}, map[string]any{
+			"enqueued":   integerSchema,
+			"duplicates": integerSchema,
+			"invalid":    integerSchema,
+			"results":    arrayOf(ref("BatchItemResult")),
+		}),
+		"BatchItemResult": object([]string{"index", "status"}, map[string]any{
+			"index":        integerSchema,
+			"status":       stringEnum(BatchItemEnqueued, BatchItemDuplicate, BatchItemInvalid),
+			"id":           stringSchema,
+			"error":        stringSchema,
+			"problems":     arrayOf(ref("ValidationProblem")),
+			"notification": ref("Notification"),
+		}),
+		"PreviewRequest": object([]string{"type"}, map[string]any{
+			"type":      ref("NotificationType"),
+			"recipient": stringSchema,
+			"metadata":  mapOf(stringSchema),
+			"language":  map[string]any{"type": "string", "description": "Defaults to " + defaultLanguage},
+		}),
+		"PreviewResponse": object([]string{"type", "language", "email", "push", "warnings"}, map[string]any{
+			"type":     ref("NotificationType"),
+			"language": stringSchema,
+			"email": object([]string{"subject", "html"}, map[string]any{
+				"subject": stringSchema,
+				"html":    stringSchema,
+			}),
+			"push": nullable(object([]string{"title", "body", "url"}, map[string]any{
+				"title": stringSchema,
+				"body":  stringSchema,
+				"url":   stringSchema,
+			})),
+			"warnings": arrayOf(ref("ValidationProblem")),
+		}),
+		"QueuePage": object([]string{"count", "nextCursor", "notifications", "summary"}, map[string]any{
+			"count":         integerSchema,
+			"nextCursor":    map[string]any{"type": "string", "description": "Empty on the last page"},
+			"notifications": arrayOf(ref("Notification")),
+			"summary": object([]string{"total", "byStatus", "byType"}, map[string]any{
+				"total":    integerSchema,
+				"byStatus": mapOf(integerSchema),
+				"byType":   mapOf(integerSchema),
+			}),
+		}),
+		"QueueEvent": object([]string{"id", "event", "notificationId", "type", "at"}, map[string]any{
+			"id": integerSchema,
+			"event": stringEnum(queue.EventEnqueued, queue.EventProcessing, queue.EventDelivery,
+				queue.EventRetry, queue.EventCompleted, queue.EventCancelled),
+			"notificationId": stringSchema,
+			"type":           ref("NotificationType"),
+			"status":         ref("NotificationStatus"),
+			"attempt":        integerSchema,
+			"delivery":       ref("DeliveryResult"),
+			"error":          stringSchema,
+			"at":             dateTimeSchema,
+		}),
+		"NotificationTypeCatalog": object([]string{"count", "types"}, map[string]any{
+			"count": integerSchema,
+			"types": arrayOf(ref("NotificationTypeInfo")),
+		}),
+		"NotificationTypeInfo": object([]string{"type", "description", "audience", "channels", "recipientRequired",
+			"requiredMetadata", "optionalMetadata", "defaultPriority", "languages", "defaultLanguage", "example"}, map[string]any{
+			"type":              ref("NotificationType"),
+			"description":       stringSchema,
+			"audience":          stringEnum(models.AudienceRecipient, models.AudienceMentionedUsers, models.AudienceBroadcast),
+			"channels":          arrayOf(stringEnum(models.ChannelEmail, models.ChannelPush)),
+			"recipientRequired": booleanSchema,
+			"requiredMetadata":  arrayOf(ref("MetadataField")),
+			"optionalMetadata":  arrayOf(ref("MetadataField")),
+			"defaultPriority":   ref("Priority"),
+			"languages":         arrayOf(stringSchema),
+			"defaultLanguage":   stringSchema,
+			"example":           ref("NotificationRequest"),
+		}),
+		"MetadataField": object([]string{"key", "format", "description", "example"}, map[string]any{
+			"key":         stringSchema,
+			"format":      stringEnum(models.FormatText, models.FormatObjectID, models.FormatObjectIDList, models.FormatURL),
+			"description": stringSchema,
+			"example":     stringSchema,
+		}),
+	}
+
+	for _, notificationType := range models.NotificationTypes {
+		schema, _ := models.SchemaFor(notificationType)
+		schemas[requestSchemaName(notificationType)] = typedRequestSchema(schema)
+		schemas[metadataSchemaName(notificationType)] = metadataSchema(schema)
+	}
+
+	return map[string]any{
+		"schemas": schemas,
+		"securitySchemes": map[string]any{
+			"ApiKeyAuth": map[string]any{"type": "apiKey", "in": "header", "name": middleware.HeaderAPIKey},
+			"RequestSignature": map[string]any{
+				"type":        "apiKey",
+				"in":          "header",
+				"name":        middleware.HeaderSignature,
+				"description": "key=<key name>,t=<unix seconds>,nonce=<unique value>,v1=<hex HMAC-SHA256 of the method, path with query, t, nonce and body>. See docs/security.md.",
+			},
+			"BearerAuth": map[string]any{
+				"type":         "http",
+				"scheme":       "bearer",
+				"bearerFormat": "JWT",
+				"description":  "A JWT issued by the Jorbites backend; its scope claim grants scopes like an API key. See docs/security.md.",
+			},
+		},
+	}
+}
+
+// notificationRequestSchema accepts the request body of any notification
+// type, telling them apart by their type.
+func notificationRequestSchema() map[string]any {
+	oneOf := make([]any, 0, len(models.NotificationTypes))
+	mapping := map[string]any{}
+	for _, notificationType := range models.NotificationTypes {
+		name := requestSchemaName(notificationType)
+		oneOf = append(oneOf, ref(name))
+		mapping[string(notificationType)] = "#/components/schemas/" + name
+	}
+	return map[string]any{
+		"oneOf":         oneOf,
+		"discriminator": map[string]any{"propertyName": "type", "mapping": mapping},
+	}
+}
+
+func requestSchemaName(notificationType models.NotificationType) string {
+	return "NotificationRequest." + string(notificationType)
+}
+
+func metadataSchemaName(notificationType models.NotificationType) string {
+	return "Metadata." + string(notificationType)
+}
+
+func typedRequestSchema(schema models.NotificationSchema) map[string]any {
+	required := []string{"type"}
+	if schema.RecipientRequired {
+		required = append(required, "recipient")
+	}
+	if len(schema.Required) > 0 {
+		required = append(required, "metadata")
+	}
+
+	request := object(required, map[string]any{
+		"type":           stringEnum(schema.Type),
+		"recipient":      map[string]any{"type": "string", "format": "email"},
+		"metadata":       ref(metadataSchemaName(schema.Type)),
+		"sendAt":         dateTimeSchema,
+		"delaySeconds":   map[string]any{"type": "integer", "minimum": 0},
+		"idempotencyKey": map[string]any{"type": "string", "maxLength": maxIdempotencyKeyLen},
+		"priority":       ref("Priority"),
+		"dryRun":         booleanSchema,
+		"callbackUrl":    map[string]any{"type": "string", "format": "uri"},
+	})
+	request["description"] = schema.Description
+	return request
+}
+
+// metadataSchema describes the metadata of a notification type. Keys the type
+// doesn't declare are accepted and ignored.
+func metadataSchema(schema models.NotificationSchema) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for _, field := range schema.Required {
+		properties[field.Key] = metadataFieldSchema(field)
+		required = append(required, field.Key)
+	}
+	for _, field := range schema.Optional {
+		properties[field.Key] = metadataFieldSchema(field)
+	}
+
+	metadata := object(required, properties)
+	metadata["additionalProperties"] = stringSchema
+	return metadata
+}
+
+const objectIDPattern = "[0-9a-fA-F]{24}"
+
+func metadataFieldSchema(field models.MetadataField) map[string]any {
+	schema := map[string]any{
+		"type":        "string",
+		"description": field.Description,
+		"example":     field.Example,
+	}
+	switch field.Format {
+	case models.FormatObjectID:
+		schema["pattern"] = "^" + objectIDPattern + "$"
+	case models.FormatObjectIDList:
+		schema["pattern"] = "^" + objectIDPattern + "(," + objectIDPattern + ")*$"
+	case models.FormatURL:
+		schema["format"] = "uri"
+	default:
+		schema["minLength"] = 1
+	}
+	return schema
+}
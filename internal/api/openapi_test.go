@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
+	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/ratelimit"
+)
+
+const (
+	testAPIKey   = "test-key"
+	readerAPIKey = "reader-key"
+)
+
+// newTestRouter serves the real handlers over an in-memory queue whose
+// workers are not started, so notifications stay pending.
+func newTestRouter(t *testing.T) http.Handler {
+	keys, err := middleware.NewKeyRing(&config.Config{
+		APIKey:  testAPIKey,
+		APIKeys: `[{"name":"reader","key":"` + readerAPIKey + `","scopes":["notifications:read"]}]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := queue.NewQueue(&config.Config{
+		MongoURI:              "mongodb://127.0.0.1:1",
+		MongoDB:               "test",
+		QueueBackend:          config.QueueBackendMemory,
+		WorkerCount:           1,
+		QueueMaxAttempts:      1,
+		NotificationRetention: time.Hour,
+		IdempotencyWindow:     time.Hour,
+	})
+	t.Cleanup(func() { q.Shutdown(context.Background()) })
+	auth := &middleware.Authenticator{
+		Keys:       keys,
+		Signatures: middleware.NewSignatureVerifier(keys, middleware.NewMemoryNonceStore(), time.Minute),
+	}
+	limits, err := ratelimit.LoadLimits(&config.Config{
+		QueueMaxDepth:      1000,
+		NotificationLimits: `{"NOTIFICATIONS_ACTIVATED":{"rate":0.001,"burst":1},"NEW_BADGE":{"maxDepth":1}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRouter(NewNotificationHandler(q, ratelimit.NewLimiter(limits)), auth)
+}
+
+// loadOpenAPI returns the document as served, decoded into plain values.
+func loadOpenAPI(t *testing.T, router http.Handler) map[string]any {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json = %d", rec.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decoding OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+var operationMethods = []string{"get", "put", "post", "delete", "patch"}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	router := newTestRouter(t)
+	doc := loadOpenAPI(t, router)
+	paths := doc["paths"].(map[string]any)
+
+	routes := Routes(&NotificationHandler{})
+	if len(paths) != len(routes) {
+		t.Errorf("OpenAPI documents %d paths, the router serves %d", len(paths), len(routes))
+	}
+	for _, route := range routes {
+		item, ok := paths[route.Pattern].(map[string]any)
+		if !ok {
+			t.Errorf("route %s is not documented", route.Pattern)
+			continue
+		}
+		var documented []string
+		for _, method := range operationMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			documented = append(documented, strings.ToUpper(method))
+			security, hasSecurity := op["security"].([]any)
+			if public := hasSecurity && len(security) == 0; public != route.Public {
+				t.Errorf("%s %s documented as public = %t, served as public = %t", method, route.Pattern, public, route.Public)
+			}
+			scope, _ := op["x-scope"].(string)
+			if served := string(route.Scopes[strings.ToUpper(method)]); scope != served {
+				t.Errorf("%s %s documents scope %q, the router requires %q", method, route.Pattern, scope, served)
+			}
+		}
+		slices.Sort(documented)
+		served := slices.Clone(route.Methods)
+		slices.Sort(served)
+		if !slices.Equal(documented, served) {
+			t.Errorf("%s documents methods %v, the handler serves %v", route.Pattern, documented, served)
+		}
+	}
+}
+
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	router := newTestRouter(t)
+	doc := loadOpenAPI(t, router)
+
+	validLike := `{"type":"NEW_LIKE","recipient":"user@example.com","metadata":{"recipeId":"65a1b2c3d4e5f6a7b8c9d0e1","likedBy":"User2"},"idempotencyKey":"like-1"}`
+	activated := `{"type":"NOTIFICATIONS_ACTIVATED","recipient":"user@example.com"}`
+	badge := `{"type":"NEW_BADGE","recipient":"user@example.com","metadata":{"badgeName":"level_100"}}`
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	tests := []struct {
+		method  string
+		pattern string
+		path    string
+		body    string
+		key     string
+		status  int
+		capture any
+	}{
+		{"GET", "/health", "/health", "", "", 200, nil},
+		{"GET", "/openapi.json", "/openapi.json", "", "", 200, nil},
+		{"GET", "/notification-types", "/notification-types", "", "", 200, nil},
+		{"POST", "/notifications", "/notifications", validLike, testAPIKey, 201, &created},
+		{"POST", "/notifications", "/notifications", validLike, testAPIKey, 200, nil},
+		{"POST", "/notifications", "/notifications", strings.Replace(validLike, "User2", "User3", 1), testAPIKey, 422, nil},
+		{"POST", "/notifications", "/notifications", `{"type":"NEW_LIKE"}`, testAPIKey, 422, nil},
+		{"POST", "/notifications", "/notifications", `{"type":"NOTIFICATIONS_ACTIVATED","recipient":"user@example.com","callbackUrl":"http://169.254.169.254/"}`, testAPIKey, 422, nil},
+		{"POST", "/notifications", "/notifications", `{`, testAPIKey, 400, nil},
+		{"POST", "/notifications", "/notifications", strings.Repeat(" ", middleware.MaxBodyBytes+1), testAPIKey, 413, nil},
+		{"POST", "/notifications", "/notifications", validLike, "", 401, nil},
+		{"POST", "/notifications", "/notifications", validLike, readerAPIKey, 403, nil},
+		{"POST", "/notifications", "/notifications", activated, testAPIKey, 201, nil},
+		{"POST", "/notifications", "/notifications", activated, testAPIKey, 429, nil},
+		{"POST", "/notifications/batch", "/notifications/batch", "[" + validLike + `,{"type":"NEW_RECIPE","metadata":{"recipeId":"x"}}]`, testAPIKey, 200, nil},
+		{"POST", "/notifications/batch", "/notifications/batch", `[]`, testAPIKey, 400, nil},
+		{"POST", "/notifications/batch", "/notifications/batch", "[" + badge + "," + badge + "]", testAPIKey, 429, nil},
+		{"POST", "/notifications", "/notifications", badge, testAPIKey, 201, nil},
+		{"GET", "/notifications/{id}", "/notifications/{created}", "", testAPIKey, 200, nil},
+		{"GET", "/notifications/{id}", "/notifications/missing", "", testAPIKey, 404, nil},
+		{"DELETE", "/notifications/{id}", "/notifications/{created}", "", testAPIKey, 200, nil},
+		{"DELETE", "/notifications/{id}", "/notifications/{created}", "", testAPIKey, 409, nil},
+		{"POST", "/preview", "/preview", `{"type":"NEW_RECIPE","metadata":{"recipeId":"65a1b2c3d4e5f6a7b8c9d0e1"}}`, testAPIKey, 200, nil},
+		{"POST", "/preview", "/preview", `{"type":"FORGOT_PASSWORD","language":"en"}`, testAPIKey, 200, nil},
+		{"POST", "/preview", "/preview", `{"type":"UNKNOWN"}`, testAPIKey, 422, nil},
+		{"GET", "/queue", "/queue?limit=1&status=pending,cancelled", "", testAPIKey, 200, nil},
+		{"GET", "/queue", "/queue?limit=0", "", testAPIKey, 400, nil},
+		{"GET", "/queue/events", "/queue/events?type=NEW_LIKE", "", testAPIKey, 200, nil},
+		{"GET", "/queue/events", "/queue/events?type=UNKNOWN", "", testAPIKey, 400, nil},
+		{"GET", "/queue/dead-letters", "/queue/dead-letters", "", testAPIKey, 200, nil},
+		{"DELETE", "/queue/dead-letters", "/queue/dead-letters", "", testAPIKey, 200, nil},
+		{"POST", "/queue/dead-letters/replay", "/queue/dead-letters/replay", "", testAPIKey, 200, nil},
+		{"DELETE", "/queue/dead-letters/{id}", "/queue/dead-letters/missing", "", testAPIKey, 404, nil},
+		{"POST", "/queue/dead-letters/{id}/replay", "/queue/dead-letters/missing/replay", "", testAPIKey, 404, nil},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		path := "/v1" + strings.ReplaceAll(tt.path, "{created}", created.Data.ID)
+		name := tt.method + " " + path
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body)).WithContext(ctx)
+		if tt.key != "" {
+			req.Header.Set(middleware.HeaderAPIKey, tt.key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		cancel()
+
+		if rec.Code != tt.status {
+			t.Errorf("%s = %d %s, want %d", name, rec.Code, rec.Body.String(), tt.status)
+			continue
+		}
+		covered[strings.ToLower(tt.method)+" "+tt.pattern] = true
+
+		op := jsonPath(doc, "paths", tt.pattern, strings.ToLower(tt.method)).(map[string]any)
+		response, ok := op["responses"].(map[string]any)[fmt.Sprint(tt.status)].(map[string]any)
+		if !ok {
+			t.Errorf("%s answered %d, which is not documented", name, tt.status)
+			continue
+		}
+		contentType, _, _ := strings.Cut(rec.Header().Get("Content-Type"), ";")
+		media, ok := response["content"].(map[string]any)[contentType].(map[string]any)
+		if !ok {
+			t.Errorf("%s answered %d with %s, which is not documented", name, tt.status, contentType)
+			continue
+		}
+		if contentType == "text/event-stream" {
+			continue
+		}
+
+		var body any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s body %q: %v", name, rec.Body.String(), err)
+			continue
+		}
+		for _, problem := range validateSchema(doc, media["schema"], body, "body") {
+			t.Errorf("%s: %s", name, problem)
+		}
+		if tt.capture != nil {
+			json.Unmarshal(rec.Body.Bytes(), tt.capture)
+		}
+	}
+
+	for pattern, item := range doc["paths"].(map[string]any) {
+		for _, method := range operationMethods {
+			if _, ok := item.(map[string]any)[method]; ok && !covered[method+" "+pattern] {
+				t.Errorf("%s %s is not exercised by this test", strings.ToUpper(method), pattern)
+			}
+		}
+	}
+}
+
+func TestOpenAPINotificationRequestMatchesCatalog(t *testing.T) {
+	doc := loadOpenAPI(t, newTestRouter(t))
+	request := map[string]any{"$ref": "#/components/schemas/NotificationRequest"}
+
+	for _, info := range NotificationTypeCatalog() {
+		var example any
+		encoded, _ := json.Marshal(info.Example)
+		json.Unmarshal(encoded, &example)
+		for _, problem := range validateSchema(doc, request, example, string(info.Type)+" example") {
+			t.Error(problem)
+		}
+
+		if len(info.Required) > 0 {
+			delete(example.(map[string]any)["metadata"].(map[string]any), info.Required[0].Key)
+			if len(validateSchema(doc, request, example, "")) == 0 {
+				t.Errorf("%s example without metadata.%s passes the OpenAPI schema", info.Type, info.Required[0].Key)
+			}
+		}
+	}
+}
+
+func jsonPath(value any, keys ...string) any {
+	for _, key := range keys {
+		value = value.(map[string]any)[key]
+	}
+	return value
+}
+
+// validateSchema checks value against the subset of OpenAPI schemas the
+// document uses. Objects with properties must not have undeclared members
+// unless additionalProperties is set, so the document can't fall behind the
+// handlers.
+func validateSchema(doc map[string]any, schemaValue any, value any, at string) []string {
+	schema := schemaValue.(map[string]any)
+	if r, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(r, "#/components/schemas/")
+		return validateSchema(doc, jsonPath(doc, "components", "schemas", name), value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+
+	var problems []string
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, s := range allOf {
+			problems = append(problems, validateSchema(doc, s, value, at)...)
+		}
+		return problems
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, s := range oneOf {
+			if len(validateSchema(doc, s, value, at)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s matches %d of the oneOf schemas, want 1", at, matches)}
+		}
+		return nil
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s = %v is not one of %v", at, value, enum))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s = %v is not an object", at, value))
+		}
+		required, _ := schema["required"].([]any)
+		for _, required := range required {
+			if _, ok := object[required.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", at, required))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		additional := schema["additionalProperties"]
+		for key, member := range object {
+			if property, ok := properties[key]; ok {
+				problems = append(problems, validateSchema(doc, property, member, at+"."+key)...)
+			} else if additional != nil {
+				problems = append(problems, validateSchema(doc, additional, member, at+"."+key)...)
+			} else if properties != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s is not documented", at, key))
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s = %v is not an array", at, value))
+		}
+		for i, item := range array {
+			problems = append(problems, validateSchema(doc, schema["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s = %v is not a string", at, value))
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && len(s) < int(minLength) {
+			problems = append(problems, fmt.Sprintf("%s is shorter than %v", at, minLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			problems = append(problems, fmt.Sprintf("%s = %q doesn't match %s", at, s, pattern))
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				problems = append(problems, fmt.Sprintf("%s = %q is not a date-time", at, s))
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%s = %v is not an integer", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s = %v is not a boolean", at, value))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/jorbush/jorbites-notifier/internal/i18n"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/queue"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+const defaultLanguage = "es"
+
+type PreviewRequest struct {
+	Type      models.NotificationType `json:"type"`
+	Recipient string                  `json:"recipient,omitempty"`
+	Metadata  map[string]string       `json:"metadata,omitempty"`
+	Language  string                  `json:"language,omitempty"`
+}
+
+// Preview renders the email and push content of a notification without
+// sending anything. Metadata problems are reported as warnings rather than
+// rejected, so incomplete payloads can still be previewed.
+func Preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.MethodNotAllowed(w, r)
+		return
+	}
+
+	var request PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		if !respond.BodyTooLarge(w, r, err) {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidRequest, "Invalid preview data: "+err.Error())
+		}
+		return
+	}
+
+	notification := models.Notification{
+		Type:      request.Type,
+		Recipient: request.Recipient,
+		Metadata:  request.Metadata,
+	}
+
+	if request.Type == "" {
+		respond.ValidationProblems(w, r, []models.ValidationProblem{{Field: "type", Message: "is required"}})
+		return
+	}
+	schema, ok := models.SchemaFor(request.Type)
+	if !ok {
+		respond.ValidationProblems(w, r, []models.ValidationProblem{{Field: "type", Message: "unknown notification type " + string(request.Type)}})
+		return
+	}
+
+	language := request.Language
+	if !slices.Contains(i18n.SupportedLanguages(request.Type), language) {
+		language = defaultLanguage
+	}
+
+	rendered, err := queue.Render(notification, language)
+	if err != nil {
+		log.Printf("Error rendering preview for %s: %v", request.Type, err)
+		respond.Error(w, r, http.StatusUnprocessableEntity, respond.CodeRenderFailed, "Error rendering notification: "+err.Error())
+		return
+	}
+
+	warnings := schema.Validate(notification)
+	if warnings == nil {
+		warnings = []models.ValidationProblem{}
+	}
+
+	respond.JSON(w, r, http.StatusOK, map[string]any{
+		"type":     request.Type,
+		"language": rendered.Language,
+		"email":    rendered.Email,
+		"push":     rendered.Push,
+		"warnings": warnings,
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jorbush/jorbites-notifier/internal/middleware"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
+)
+
+// Route is an endpoint of the API. Routes are public or require an API key
+// granting the scope listed for each method.
+type Route struct {
+	Pattern string
+	Methods []string
+	Handler http.HandlerFunc
+	Public  bool
+	Scopes  map[string]models.Scope
+}
+
+// Routes lists every endpoint of the API, as served under /v1/ and by the
+// unversioned aliases.
+func Routes(h *NotificationHandler) []Route {
+	const (
+		get   = http.MethodGet
+		post  = http.MethodPost
+		del   = http.MethodDelete
+		write = models.ScopeNotificationsWrite
+		read  = models.ScopeNotificationsRead
+		queue = models.ScopeQueueRead
+		admin = models.ScopeAdmin
+	)
+	return []Route{
+		{"/health", []string{get}, HealthCheckHandler, true, nil},
+		{"/openapi.json", []string{get}, OpenAPIHandler, true, nil},
+		{"/notification-types", []string{get}, NotificationTypes, true, nil},
+		{"/notifications", []string{post}, h.EnqueueNotification, false, map[string]models.Scope{post: write}},
+		{"/notifications/batch", []string{post}, h.EnqueueBatch, false, map[string]models.Scope{post: write}},
+		{"/notifications/{id}", []string{get, del}, h.Notification, false, map[string]models.Scope{get: read, del: write}},
+		{"/preview", []string{post}, Preview, false, map[string]models.Scope{post: write}},
+		{"/queue", []string{get}, h.GetQueueStatus, false, map[string]models.Scope{get: queue}},
+		{"/queue/events", []string{get}, h.QueueEvents, false, map[string]models.Scope{get: queue}},
+		{"/queue/dead-letters", []string{get, del}, h.DeadLetters, false, map[string]models.Scope{get: queue, del: admin}},
+		{"/queue/dead-letters/replay", []string{post}, h.ReplayDeadLetters, false, map[string]models.Scope{post: admin}},
+		{"/queue/dead-letters/{id}", []string{del}, h.DeadLetter, false, map[string]models.Scope{del: admin}},
+		{"/queue/dead-letters/{id}/replay", []string{post}, h.ReplayDeadLetter, false, map[string]models.Scope{post: admin}},
+	}
+}
+
+// NewRouter serves every route under /v1/, with enveloped responses and
+// problem errors, and unversioned for existing clients.
+func NewRouter(h *NotificationHandler, auth *middleware.Authenticator) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range Routes(h) {
+		handler := route.Handler
+		if !route.Public {
+			handler = auth.Require(route.Scopes, handler)
+		}
+		handler = middleware.LimitBody(handler)
+		mux.HandleFunc(route.Pattern, handler)
+		mux.HandleFunc("/v1"+route.Pattern, respond.V1(handler))
+	}
+	mux.HandleFunc("/v1/", respond.V1(respond.NotFound))
+	return mux
+}
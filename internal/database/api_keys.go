@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const apiKeysCollection = "api_keys"
+
+// ListAPIKeys returns every API key in the api_keys collection.
+func (m *MongoDB) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	collection := m.db.Collection(apiKeysCollection)
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.APIKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const deadLettersCollection = "notification_dead_letters"
+
+func (m *MongoDB) InsertDeadLetter(ctx context.Context, deadLetter models.DeadLetter) error {
+	collection := m.db.Collection(deadLettersCollection)
+	opts := options.Replace().SetUpsert(true)
+	_, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: deadLetter.ID}}, deadLetter, opts)
+	return err
+}
+
+func (m *MongoDB) ListDeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	collection := m.db.Collection(deadLettersCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "failed_at", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deadLetters := []models.DeadLetter{}
+	if err = cursor.All(ctx, &deadLetters); err != nil {
+		return nil, err
+	}
+	return deadLetters, nil
+}
+
+func (m *MongoDB) GetDeadLetter(ctx context.Context, id string) (*models.DeadLetter, error) {
+	collection := m.db.Collection(deadLettersCollection)
+	var deadLetter models.DeadLetter
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&deadLetter)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+// DeleteDeadLetter removes a dead letter and reports whether it existed.
+func (m *MongoDB) DeleteDeadLetter(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Collection(deadLettersCollection)
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (m *MongoDB) DeleteAllDeadLetters(ctx context.Context) (int64, error) {
+	collection := m.db.Collection(deadLettersCollection)
+	result, err := collection.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
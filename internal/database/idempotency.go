@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const idempotencyKeysCollection = "notification_idempotency_keys"
+
+// EnsureIdempotencyKeyIndexes lets MongoDB delete expired keys on its own.
+func (m *MongoDB) EnsureIdempotencyKeyIndexes(ctx context.Context) error {
+	collection := m.db.Collection(idempotencyKeysCollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// ReserveIdempotencyKey stores record unless its key is already held by an
+// unexpired record, in which case that record is returned and nothing is
+// stored. It returns nil when the key was reserved.
+func (m *MongoDB) ReserveIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	collection := m.db.Collection(idempotencyKeysCollection)
+
+	_, err := collection.InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// The TTL monitor only runs every minute, so an expired record may still
+	// be there; take it over in that case.
+	filter := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: time.Now().UTC()}}},
+	}
+	result, err := collection.ReplaceOne(ctx, filter, record)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount > 0 {
+		return nil, nil
+	}
+
+	var existing models.IdempotencyRecord
+	if err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: record.Key}}).Decode(&existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (m *MongoDB) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	collection := m.db.Collection(idempotencyKeysCollection)
+	_, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: key}})
+	return err
+}
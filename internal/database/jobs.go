@@ -0,0 +1,413 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const notificationJobsCollection = "notification_jobs"
+
+var activeJobStatuses = bson.A{models.StatusPending, models.StatusProcessing}
+
+// EnsureNotificationJobIndexes creates the indexes used to claim jobs in order
+// and the TTL index that removes completed jobs once they expire.
+func (m *MongoDB) EnsureNotificationJobIndexes(ctx context.Context) error {
+	collection := m.db.Collection(notificationJobsCollection)
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "lease_expires_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+func (m *MongoDB) InsertNotificationJob(ctx context.Context, notification models.Notification) error {
+	collection := m.db.Collection(notificationJobsCollection)
+	_, err := collection.InsertOne(ctx, notification)
+	return err
+}
+
+// InsertNotificationJobs inserts a batch of jobs. If the insert fails partway
+// the jobs that were written are removed again, so the batch is either queued
+// in full or not at all.
+func (m *MongoDB) InsertNotificationJobs(ctx context.Context, notifications []models.Notification) error {
+	collection := m.db.Collection(notificationJobsCollection)
+	_, err := collection.InsertMany(ctx, notifications)
+	if err == nil {
+		return nil
+	}
+
+	ids := make(bson.A, len(notifications))
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if _, cleanupErr := collection.DeleteMany(context.WithoutCancel(ctx), filter); cleanupErr != nil {
+		return errors.Join(err, cleanupErr)
+	}
+	return err
+}
+
+// ClaimNotificationJob atomically takes a pending job that is due, or a
+// processing job whose lease has expired, leases it to owner and counts the
+// attempt. Jobs are taken oldest first, by highest priority first when
+// byPriority is set. It returns nil when there is nothing to claim.
+func (m *MongoDB) ClaimNotificationJob(ctx context.Context, owner string, lease time.Duration, byPriority bool) (*models.Notification, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{
+			{Key: "status", Value: models.StatusPending},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "next_attempt_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}}},
+			}},
+		},
+		bson.D{
+			{Key: "status", Value: models.StatusProcessing},
+			{Key: "lease_expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+		},
+	}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.StatusProcessing},
+			{Key: "lease_owner", Value: owner},
+			{Key: "lease_expires_at", Value: now.Add(lease)},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$push", Value: bson.D{{Key: "lifecycle", Value: models.StatusChange{
+			Status: models.StatusProcessing,
+			At:     now,
+			Detail: "claimed by " + owner,
+		}}}},
+	}
+	sort := bson.D{{Key: "created_at", Value: 1}}
+	if byPriority {
+		sort = bson.D{{Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(sort).
+		SetReturnDocument(options.After)
+
+	var notification models.Notification
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&notification)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// ExtendNotificationJobLease renews the lease of a job still owned by owner.
+func (m *MongoDB) ExtendNotificationJobLease(ctx context.Context, id string, owner string, lease time.Duration) error {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "lease_owner", Value: owner}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "lease_expires_at", Value: now.Add(lease)},
+		{Key: "updated_at", Value: now},
+	}}}
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RetryNotificationJob releases the lease owner holds on a failed job, appends
+// the failed attempt to its history and schedules the next attempt. A non-nil
+// report replaces the job's delivery report, and an interrupted attempt is
+// given back. It reports whether owner still held the lease; if not, the job
+// is left alone.
+func (m *MongoDB) RetryNotificationJob(ctx context.Context, id string, owner string, nextAttemptAt time.Time, attempt models.Attempt, report *models.DeliveryReport) (bool, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	set := bson.D{
+		{Key: "status", Value: models.StatusPending},
+		{Key: "next_attempt_at", Value: nextAttemptAt},
+		{Key: "last_error", Value: attempt.Error},
+		{Key: "updated_at", Value: now},
+	}
+	if report != nil {
+		set = append(set, bson.E{Key: "delivery", Value: report})
+	}
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$push", Value: bson.D{
+			{Key: "history", Value: attempt},
+			{Key: "lifecycle", Value: models.StatusChange{
+				Status: models.StatusPending,
+				At:     now,
+				Detail: "retry scheduled for " + nextAttemptAt.Format(time.RFC3339),
+			}},
+		}},
+		{Key: "$unset", Value: bson.D{
+			{Key: "lease_owner", Value: ""},
+			{Key: "lease_expires_at", Value: ""},
+		}},
+	}
+	if attempt.Interrupted {
+		update = append(update, bson.E{Key: "$inc", Value: bson.D{{Key: "attempts", Value: -1}}})
+	}
+	result, err := collection.UpdateOne(ctx, leasedJob(id, owner), update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// CompleteNotificationJob gives a job leased to owner its terminal status and
+// delivery report, and reports whether owner still held the lease. The TTL
+// index removes the job once expiresAt has passed.
+func (m *MongoDB) CompleteNotificationJob(ctx context.Context, id string, owner string, status models.NotificationStatus, report *models.DeliveryReport, expiresAt time.Time) (bool, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "delivery", Value: report},
+			{Key: "completed_at", Value: now},
+			{Key: "expires_at", Value: expiresAt},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$push", Value: bson.D{{Key: "lifecycle", Value: models.StatusChange{
+			Status: status,
+			At:     now,
+		}}}},
+		{Key: "$unset", Value: bson.D{
+			{Key: "lease_owner", Value: ""},
+			{Key: "lease_expires_at", Value: ""},
+			{Key: "next_attempt_at", Value: ""},
+		}},
+	}
+	result, err := collection.UpdateOne(ctx, leasedJob(id, owner), update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// leasedJob matches the job id while it is being processed under a lease held
+// by owner.
+func leasedJob(id string, owner string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "status", Value: models.StatusProcessing},
+		{Key: "lease_owner", Value: owner},
+	}
+}
+
+// CancelNotificationJob marks a pending job cancelled. It returns nil when no
+// pending job has the given ID, e.g. because a worker has already claimed it.
+func (m *MongoDB) CancelNotificationJob(ctx context.Context, id string, expiresAt time.Time) (*models.Notification, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: models.StatusPending}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.StatusCancelled},
+			{Key: "completed_at", Value: now},
+			{Key: "expires_at", Value: expiresAt},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$push", Value: bson.D{{Key: "lifecycle", Value: models.StatusChange{
+			Status: models.StatusCancelled,
+			At:     now,
+		}}}},
+		{Key: "$unset", Value: bson.D{{Key: "next_attempt_at", Value: ""}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var notification models.Notification
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&notification)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// GetNotificationJob returns a job in any status. Jobs past their expiry are
+// treated as missing even if the TTL monitor hasn't removed them yet.
+func (m *MongoDB) GetNotificationJob(ctx context.Context, id string) (*models.Notification, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}}},
+		}},
+	}
+
+	var notification models.Notification
+	if err := collection.FindOne(ctx, filter).Decode(&notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// NotificationJobFilter selects jobs for ListNotificationJobs and
+// CountNotificationJobs. Empty fields don't filter.
+type NotificationJobFilter struct {
+	Types         []models.NotificationType
+	Statuses      []models.NotificationStatus
+	Recipient     string
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	// AfterCreatedAt and AfterID resume a listing after the given job.
+	AfterCreatedAt *time.Time
+	AfterID        string
+	Limit          int
+}
+
+func (f NotificationJobFilter) query() bson.D {
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}}},
+	}}}
+	if len(f.Statuses) > 0 {
+		filter = append(filter, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: f.Statuses}}})
+	}
+	if len(f.Types) > 0 {
+		filter = append(filter, bson.E{Key: "type", Value: bson.D{{Key: "$in", Value: f.Types}}})
+	}
+	if f.Recipient != "" {
+		filter = append(filter, bson.E{Key: "recipient", Value: f.Recipient})
+	}
+
+	createdAt := bson.D{}
+	if f.CreatedBefore != nil {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: *f.CreatedBefore})
+	}
+	if f.CreatedAfter != nil {
+		createdAt = append(createdAt, bson.E{Key: "$gt", Value: *f.CreatedAfter})
+	}
+	if len(createdAt) > 0 {
+		filter = append(filter, bson.E{Key: "created_at", Value: createdAt})
+	}
+
+	if f.AfterCreatedAt != nil {
+		filter = append(filter, bson.E{Key: "$and", Value: bson.A{
+			bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "created_at", Value: bson.D{{Key: "$gt", Value: *f.AfterCreatedAt}}}},
+				bson.D{
+					{Key: "created_at", Value: *f.AfterCreatedAt},
+					{Key: "_id", Value: bson.D{{Key: "$gt", Value: f.AfterID}}},
+				},
+			}}},
+		}})
+	}
+	return filter
+}
+
+// ListNotificationJobs returns the jobs matching filter in enqueue order.
+func (m *MongoDB) ListNotificationJobs(ctx context.Context, filter NotificationJobFilter) ([]models.Notification, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := collection.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// NotificationJobCount is the number of jobs with a given status and type.
+type NotificationJobCount struct {
+	Status models.NotificationStatus
+	Type   models.NotificationType
+	Count  int
+}
+
+// CountNotificationJobs counts the jobs matching filter, grouped by status and
+// type. The cursor and limit of the filter are ignored.
+func (m *MongoDB) CountNotificationJobs(ctx context.Context, filter NotificationJobFilter) ([]NotificationJobCount, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	filter.AfterCreatedAt = nil
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter.query()}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "status", Value: "$status"}, {Key: "type", Value: "$type"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		ID struct {
+			Status models.NotificationStatus `bson:"status"`
+			Type   models.NotificationType   `bson:"type"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts := make([]NotificationJobCount, len(groups))
+	for i, group := range groups {
+		counts[i] = NotificationJobCount{Status: group.ID.Status, Type: group.ID.Type, Count: group.Count}
+	}
+	return counts, nil
+}
+
+// ReleaseExpiredNotificationJobs puts processing jobs whose lease has expired
+// back to pending so they are picked up again.
+func (m *MongoDB) ReleaseExpiredNotificationJobs(ctx context.Context) (int64, error) {
+	collection := m.db.Collection(notificationJobsCollection)
+	now := time.Now().UTC()
+
+	filter := bson.D{
+		{Key: "status", Value: models.StatusProcessing},
+		{Key: "lease_expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.StatusPending},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$push", Value: bson.D{{Key: "lifecycle", Value: models.StatusChange{
+			Status: models.StatusPending,
+			At:     now,
+			Detail: "lease expired",
+		}}}},
+		{Key: "$unset", Value: bson.D{
+			{Key: "lease_owner", Value: ""},
+			{Key: "lease_expires_at", Value: ""},
+		}},
+	}
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strings"
 
@@ -193,3 +194,8 @@ func (m *MongoDB) GetUserByID(ctx context.Context, id string) (*models.User, err
 	}
 	return &user, nil
 }
+
+// IsNotFound reports whether err means that no document matched the query.
+func IsNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const requestNoncesCollection = "request_nonces"
+
+// EnsureRequestNonceIndexes lets MongoDB delete expired nonces on its own.
+func (m *MongoDB) EnsureRequestNonceIndexes(ctx context.Context) error {
+	collection := m.db.Collection(requestNoncesCollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// UseRequestNonce records nonce until expiresAt. It returns false when the
+// nonce was already recorded, i.e. the request is a replay.
+func (m *MongoDB) UseRequestNonce(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	collection := m.db.Collection(requestNoncesCollection)
+	_, err := collection.InsertOne(ctx, bson.D{
+		{Key: "_id", Value: nonce},
+		{Key: "expires_at", Value: expiresAt.UTC()},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
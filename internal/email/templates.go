@@ -3,7 +3,7 @@ package email
 import (
 	"bytes"
 	"fmt"
-	"text/template"
+	"html/template"
 	"time"
 
 	"github.com/jorbush/jorbites-notifier/internal/i18n"
@@ -110,11 +110,22 @@ type TemplateData struct {
 	SiteURL     string
 	LogoURL     string
 	CurrentYear int
-	Content     string
-	Footer      string
+	Content     template.HTML
+	Footer      template.HTML
 	Metadata    map[string]string
 }
 
+// trustedHTML marks fragment as safe to insert into an email without
+// escaping. It is the only conversion to a trusted template type in this
+// package, and a test keeps it that way: only pass HTML rendered by our own
+// templates, never metadata or anything else a client can set.
+func trustedHTML(fragment string) template.HTML {
+	return template.HTML(fragment)
+}
+
+// GetEmailTemplate renders the subject and HTML body of an email. Templates
+// are rendered with html/template, so metadata is escaped for the context it
+// appears in: text, attributes and URLs.
 func GetEmailTemplate(notificationType models.NotificationType, metadata map[string]string, language string) (string, string, error) {
 	const siteURL = "https://jorbites.com"
 	logoURL := siteURL + "/images/logo-nobg.webp"
@@ -141,7 +152,8 @@ func GetEmailTemplate(notificationType models.NotificationType, metadata map[str
 		return "", "", err
 	}
 
-	data.Content = contentBuf.String()
+	// The content template is ours and escaped the metadata it contains.
+	data.Content = trustedHTML(contentBuf.String())
 
 	footerTemplate := i18n.GetBaseTemplateFooter(language)
 	footerTmpl, err := template.New("footer").Parse(footerTemplate)
@@ -154,7 +166,7 @@ func GetEmailTemplate(notificationType models.NotificationType, metadata map[str
 		return "", "", err
 	}
 
-	data.Footer = footerBuf.String()
+	data.Footer = trustedHTML(footerBuf.String())
 
 	baseTmpl, err := template.New("base").Parse(BaseTemplate)
 	if err != nil {
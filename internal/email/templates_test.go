@@ -0,0 +1,126 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/i18n"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+var (
+	metadataField = regexp.MustCompile(`\.Metadata\.(\w+)`)
+	tag           = regexp.MustCompile(`<(/?\w+)([^>]*)>`)
+	attribute     = regexp.MustCompile(`\s([\w-]+)=("[^"]*"|'[^']*'|[^\s>]*)`)
+)
+
+// hostileValues are injected into every metadata field a template uses.
+var hostileValues = []string{
+	`<script>alert(1)</script>`,
+	`"><img src=x onerror=alert(1)>`,
+	`<a href="https://evil.example">Claim your prize</a>`,
+	`javascript:alert(1)`,
+	`' onmouseover='alert(1)`,
+}
+
+// markup lists the tags of an HTML document with their attribute names,
+// flagging links that would run script.
+func markup(html string) []string {
+	var tags []string
+	for _, t := range tag.FindAllStringSubmatch(html, -1) {
+		element := t[1]
+		for _, a := range attribute.FindAllStringSubmatch(t[2], -1) {
+			element += " " + a[1]
+			value := strings.ToLower(strings.Trim(a[2], `"'`))
+			if (a[1] == "href" || a[1] == "src") && strings.HasPrefix(value, "javascript:") {
+				element += "=javascript"
+			}
+		}
+		tags = append(tags, element)
+	}
+	return tags
+}
+
+func render(t *testing.T, notificationType models.NotificationType, language string, value string) string {
+	metadata := map[string]string{}
+	for _, field := range metadataField.FindAllStringSubmatch(i18n.GetEmailTemplateContent(notificationType, language), -1) {
+		metadata[field[1]] = value
+	}
+	_, html, err := GetEmailTemplate(notificationType, metadata, language)
+	if err != nil {
+		t.Fatalf("GetEmailTemplate(%s, %s) error = %v", notificationType, language, err)
+	}
+	return html
+}
+
+// TestGetEmailTemplateEscapesMetadata renders every template with hostile
+// values in every metadata field it uses, and checks they add no tags,
+// attributes or script links to what the template renders with harmless
+// values.
+func TestGetEmailTemplateEscapesMetadata(t *testing.T) {
+	types := i18n.EmailTemplateTypes()
+	if len(types) == 0 {
+		t.Fatal("no email templates")
+	}
+
+	for _, notificationType := range types {
+		for _, language := range i18n.SupportedLanguages(notificationType) {
+			name := string(notificationType) + "/" + language
+			expected := markup(render(t, notificationType, language, "value"))
+
+			for _, value := range hostileValues {
+				html := render(t, notificationType, language, value)
+				if got := markup(html); !slices.Equal(got, expected) {
+					t.Errorf("%s: %q changed the markup to %v, want %v", name, value, got, expected)
+				}
+				if strings.ContainsAny(value, `<>"'`) && strings.Contains(html, value) {
+					t.Errorf("%s: %q was inserted unescaped", name, value)
+				}
+			}
+		}
+	}
+}
+
+func TestGetEmailTemplateKeepsTemplateHTML(t *testing.T) {
+	_, html, err := GetEmailTemplate(models.TypeNewComment, map[string]string{"authorName": "Ana <3", "recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<strong>Ana &lt;3</strong>`,
+		`<a href="https://jorbites.com/recipes/65a1b2c3d4e5f6a7b8c9d0e1" class="button">`,
+		`<a href="https://jorbites.com">Settings → Email Notifications</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered email lacks %s", want)
+		}
+	}
+}
+
+// TestTrustedHTMLIsAudited keeps trustedHTML the only place this package
+// turns a string into trusted template content.
+func TestTrustedHTMLIsAudited(t *testing.T) {
+	conversion := regexp.MustCompile(`template\.(HTML|HTMLAttr|JS|JSStr|CSS|URL|Srcset)\(`)
+	files, _ := filepath.Glob("*.go")
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches := conversion.FindAllIndex(source, -1)
+		allowed := 0
+		if file == "templates.go" {
+			allowed = 1
+		}
+		if len(matches) != allowed {
+			t.Errorf("%s has %d conversions to trusted template types, want %d; use trustedHTML", file, len(matches), allowed)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package i18n
 
-import "github.com/jorbush/jorbites-notifier/internal/models"
+import (
+	"sort"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
 
 func GetUserLanguage(user *models.User) string {
 	if user.Language != nil && *user.Language != "" {
@@ -416,6 +420,28 @@ var baseTemplateFooter = map[string]string{
     `,
 }
 
+// SupportedLanguages returns the languages with an email template for the
+// notification type, sorted. Other languages fall back to Spanish.
+func SupportedLanguages(notificationType models.NotificationType) []string {
+	languages := []string{}
+	for language := range emailTemplateContent[notificationType] {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// EmailTemplateTypes returns the notification types with an email template,
+// sorted.
+func EmailTemplateTypes() []models.NotificationType {
+	types := []models.NotificationType{}
+	for notificationType := range emailTemplateContent {
+		types = append(types, notificationType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
 // GetEmailTemplateContent returns the email template content for a given notification type and language
 func GetEmailTemplateContent(notificationType models.NotificationType, language string) string {
 	templates, exists := emailTemplateContent[notificationType]
@@ -1,34 +1,145 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"strings"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/respond"
 )
 
 const (
 	HeaderAPIKey = "X-API-Key"
+	bearerPrefix = "Bearer "
 )
 
-func RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" {
-		log.Fatal("API_KEY environment variable is not set")
+type apiKeyContextKey struct{}
+
+// APIKeyFrom returns the API key that authenticated the request.
+func APIKeyFrom(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(models.APIKey)
+	return key, ok
+}
+
+// Authenticator accepts API keys and, when Signatures and Tokens are set,
+// signed requests and bearer tokens.
+type Authenticator struct {
+	Keys       *KeyRing
+	Signatures *SignatureVerifier
+	Tokens     *TokenVerifier
+}
+
+// Require authenticates requests with RequireBearerToken when they carry a
+// bearer token, RequireSignature when they are signed and RequireAPIKey
+// otherwise.
+func (a *Authenticator) Require(scopes map[string]models.Scope, next http.HandlerFunc) http.HandlerFunc {
+	apiKey := RequireAPIKey(a.Keys, scopes, next)
+	var signed, bearer http.HandlerFunc
+	if a.Signatures != nil {
+		signed = RequireSignature(a.Signatures, scopes, next)
+	}
+	if a.Tokens != nil {
+		bearer = RequireBearerToken(a.Tokens, scopes, next)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case bearer != nil && strings.HasPrefix(r.Header.Get("Authorization"), bearerPrefix):
+			bearer(w, r)
+		case signed != nil && r.Header.Get(HeaderSignature) != "":
+			signed(w, r)
+		default:
+			apiKey(w, r)
+		}
 	}
+}
+
+// RequireAPIKey lets a request through when it carries a valid, unexpired key
+// granting the scope its method requires. Methods missing from scopes only
+// need a valid key; the handler answers them itself.
+func RequireAPIKey(keys *KeyRing, scopes map[string]models.Scope, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/health" {
-			next(w, r)
+		secret := r.Header.Get(HeaderAPIKey)
+		if secret == "" {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeMissingAPIKey, "API key is missing")
 			return
 		}
-		key := r.Header.Get(HeaderAPIKey)
-		if key == "" {
-			http.Error(w, "API key is missing", http.StatusUnauthorized)
+		key, ok := keys.Lookup(secret)
+		if !ok {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidAPIKey, "Invalid API key")
 			return
 		}
-		if key != apiKey {
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		authorize(w, r, key, "API key", scopes, next)
+	}
+}
+
+// RequireSignature is RequireAPIKey for requests signed with a key instead of
+// carrying it.
+func RequireSignature(signatures *SignatureVerifier, scopes map[string]models.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := signatures.Verify(r)
+		if respond.BodyTooLarge(w, r, err) {
 			return
 		}
-		next(w, r)
+		switch {
+		case errors.Is(err, ErrReplayedRequest):
+			log.Printf("%s %s rejected: replayed signed request", r.Method, r.URL.Path)
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeReplayedRequest, "Request was already received")
+			return
+		case errors.Is(err, ErrInvalidSignature):
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidSignature, capitalize(err.Error()))
+			return
+		case err != nil:
+			log.Printf("Error checking request nonce: %v", err)
+			respond.InternalError(w, r)
+			return
+		}
+		authorize(w, r, key, "signed request from key", scopes, next)
 	}
 }
+
+// RequireBearerToken is RequireAPIKey for requests authenticated with a JWT
+// in the Authorization header.
+func RequireBearerToken(tokens *TokenVerifier, scopes map[string]models.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidToken, "Bearer token is missing")
+			return
+		}
+		key, err := tokens.Verify(token)
+		if err != nil {
+			log.Printf("%s %s rejected: %v", r.Method, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidToken, "Invalid bearer token")
+			return
+		}
+		authorize(w, r, key, "bearer token for", scopes, next)
+	}
+}
+
+// authorize lets an authenticated request through when key is unexpired and
+// grants the scope of the request method.
+func authorize(w http.ResponseWriter, r *http.Request, key models.APIKey, via string, scopes map[string]models.Scope, next http.HandlerFunc) {
+	if key.Expired(time.Now()) {
+		log.Printf("%s %s rejected: API key %q has expired", r.Method, r.URL.Path, key.Name)
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeExpiredAPIKey, "API key has expired")
+		return
+	}
+	if scope, ok := scopes[r.Method]; ok && !key.Allows(scope) {
+		log.Printf("%s %s rejected: API key %q lacks scope %s", r.Method, r.URL.Path, key.Name, scope)
+		respond.Error(w, r, http.StatusForbidden, respond.CodeInsufficientScope, "API key lacks the "+string(scope)+" scope")
+		return
+	}
+
+	log.Printf("%s %s by %s %q", r.Method, r.URL.Path, via, key.Name)
+	next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+}
+
+func capitalize(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
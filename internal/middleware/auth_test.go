@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestNewKeyRing(t *testing.T) {
+	keys, err := NewKeyRing(&config.Config{
+		APIKey:  "legacy",
+		APIKeys: `[{"name":"web","key":"web-key","scopes":["notifications:write"]},{"name":"web-next","key":"web-key-2","scopes":["notifications:write"]}]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", keys.Len())
+	}
+	// Both keys of a rotation are accepted at once.
+	for secret, name := range map[string]string{"legacy": "default", "web-key": "web", "web-key-2": "web-next"} {
+		key, ok := keys.Lookup(secret)
+		if !ok || key.Name != name {
+			t.Errorf("Lookup(%q) = %q, %t, want %q", secret, key.Name, ok, name)
+		}
+	}
+	if key, _ := keys.Lookup("legacy"); !key.Allows(models.ScopeQueueRead) {
+		t.Error("API_KEY should grant every scope")
+	}
+	if _, ok := keys.Lookup("unknown"); ok {
+		t.Error("Lookup accepted an unknown key")
+	}
+
+	for _, raw := range []string{`{`, `[{"name":"web"}]`, `[{"name":"a","key":"1"},{"name":"a","key":"2"}]`, `[{"name":"a","key":"1"},{"name":"b","key":"1"}]`} {
+		if _, err := NewKeyRing(&config.Config{APIKeys: raw}); err == nil {
+			t.Errorf("NewKeyRing(%s) succeeded", raw)
+		}
+	}
+}
+
+func TestKeyRingWatch(t *testing.T) {
+	keys, _ := NewKeyRing(&config.Config{})
+	stored := []models.APIKey{{Name: "stored", KeyHash: HashKey("stored-key"), Scopes: []models.Scope{models.ScopeQueueRead}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := keys.Watch(ctx, func(context.Context) ([]models.APIKey, error) { return stored, nil }, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := keys.Lookup("stored-key"); !ok || key.Name != "stored" {
+		t.Errorf("Lookup(stored-key) = %q, %t", key.Name, ok)
+	}
+
+	keys.Load(nil)
+	if _, ok := keys.Lookup("stored-key"); ok {
+		t.Error("a removed key is still accepted")
+	}
+}
+
+func TestKeyRingLoadRejectsCollisions(t *testing.T) {
+	keys, _ := NewKeyRing(&config.Config{APIKey: "legacy"})
+	stored := models.APIKey{Name: "stored", KeyHash: HashKey("stored-key"), Scopes: []models.Scope{models.ScopeQueueRead}}
+	if err := keys.Load([]models.APIKey{stored}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, load := range map[string][]models.APIKey{
+		"configured name":  {{Name: "default", KeyHash: HashKey("other-key")}},
+		"configured key":   {{Name: "other", KeyHash: HashKey("legacy")}},
+		"name used twice":  {stored, {Name: "stored", KeyHash: HashKey("other-key")}},
+		"key used twice":   {stored, {Name: "other", KeyHash: HashKey("stored-key")}},
+		"missing key hash": {{Name: "other"}},
+	} {
+		if err := keys.Load(load); err == nil {
+			t.Errorf("Load() with a %s succeeded", name)
+		}
+	}
+
+	// The rejected loads left the previous keys in place.
+	if key, ok := keys.Lookup("stored-key"); !ok || key.Name != "stored" {
+		t.Errorf("Lookup(stored-key) = %q, %t, want the key loaded before", key.Name, ok)
+	}
+	if key, ok := keys.Lookup("legacy"); !ok || key.Name != "default" || !key.Allows(models.ScopeAdmin) {
+		t.Errorf("Lookup(legacy) = %+v, %t, want the configured admin key", key, ok)
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	keys, err := NewKeyRing(&config.Config{
+		APIKeys: `[{"name":"writer","key":"w","scopes":["notifications:write"]},` +
+			`{"name":"old","key":"o","scopes":["admin"],"expiresAt":"` + expired + `"}]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen string
+	handler := RequireAPIKey(keys, map[string]models.Scope{http.MethodPost: models.ScopeNotificationsWrite, http.MethodGet: models.ScopeQueueRead},
+		func(w http.ResponseWriter, r *http.Request) {
+			key, _ := APIKeyFrom(r.Context())
+			seen = key.Name
+		})
+
+	tests := []struct {
+		method string
+		key    string
+		status int
+	}{
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "o", http.StatusUnauthorized},
+		{http.MethodGet, "w", http.StatusForbidden},
+		{http.MethodPost, "w", http.StatusOK},
+	}
+	for _, tt := range tests {
+		seen = ""
+		req := httptest.NewRequest(tt.method, "/notifications", nil)
+		if tt.key != "" {
+			req.Header.Set(HeaderAPIKey, tt.key)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s with key %q = %d, want %d", tt.method, tt.key, rec.Code, tt.status)
+		}
+		if want := tt.status == http.StatusOK; (seen == "writer") != want {
+			t.Errorf("%s with key %q reached the handler as %q", tt.method, tt.key, seen)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import "net/http"
+
+// MaxBodyBytes caps request bodies. A full batch of 1000 notifications takes
+// well under a megabyte.
+const MaxBodyBytes = 4 << 20
+
+// LimitBody makes reading the request body past MaxBodyBytes fail with an
+// *http.MaxBytesError. It wraps authentication too, since signed requests
+// are read in full before they are verified.
+func LimitBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+		next(w, r)
+	}
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// tokenLeeway absorbs clock drift between the backend and the notifier.
+const tokenLeeway = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// tokenClaims are the claims read from bearer tokens. Scopes can be given as
+// an OAuth-style space-separated scope claim or as a scopes array.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope  string         `json:"scope,omitempty"`
+	Scopes []models.Scope `json:"scopes,omitempty"`
+}
+
+// TokenVerifier authenticates short-lived JWTs issued by the Jorbites
+// backend, signed with HS256 and a shared secret or RS256 and a key from a
+// JWKS file.
+type TokenVerifier struct {
+	secret     []byte
+	publicKeys map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+// NewTokenVerifier returns nil when neither JWT_SECRET nor JWT_JWKS_FILE is
+// set. Tokens must carry JWT_ISSUER, JWT_AUDIENCE and an expiry.
+func NewTokenVerifier(cfg *config.Config) (*TokenVerifier, error) {
+	if cfg.JWTSecret == "" && cfg.JWTJWKSFile == "" {
+		return nil, nil
+	}
+	if cfg.JWTIssuer == "" || cfg.JWTAudience == "" {
+		return nil, errors.New("JWT_ISSUER and JWT_AUDIENCE are required to accept bearer tokens")
+	}
+
+	v := &TokenVerifier{}
+	var methods []string
+	if cfg.JWTSecret != "" {
+		v.secret = []byte(cfg.JWTSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWTJWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWTJWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", cfg.JWTJWKSFile, err)
+		}
+		v.publicKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(cfg.JWTIssuer),
+		jwt.WithAudience(cfg.JWTAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+	return v, nil
+}
+
+// Verify checks token and returns the credential it grants, named after its
+// subject and expiring with it.
+func (v *TokenVerifier) Verify(token string) (models.APIKey, error) {
+	var claims tokenClaims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return models.APIKey{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return models.APIKey{}, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	scopes := claims.Scopes
+	for _, scope := range strings.Fields(claims.Scope) {
+		scopes = append(scopes, models.Scope(scope))
+	}
+	return models.APIKey{
+		Name:      "jwt:" + claims.Subject,
+		Scopes:    scopes,
+		ExpiresAt: &claims.ExpiresAt.Time,
+	}, nil
+}
+
+// key picks the verification key for the algorithm the token claims, so an
+// HS256 token can never be checked against a public key or the reverse.
+func (v *TokenVerifier) key(token *jwt.Token) (any, error) {
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		return v.secret, nil
+	case jwt.SigningMethodRS256:
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.publicKeys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// loadJWKS reads the RSA keys of a JSON Web Key Set, indexed by key ID.
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: decoding n: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: decoding e: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA signing keys")
+	}
+	return keys, nil
+}
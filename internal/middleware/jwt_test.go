@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []any{map[string]any{
+		"kty": "RSA",
+		"kid": "backend-1",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := NewTokenVerifier(&config.Config{
+		JWTSecret:   "shared-secret",
+		JWTJWKSFile: jwksFile,
+		JWTIssuer:   "jorbites",
+		JWTAudience: "jorbites-notifier",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := NewKeyRing(&config.Config{})
+	auth := &Authenticator{Keys: keys, Tokens: tokens}
+
+	var seen models.APIKey
+	handler := auth.Require(map[string]models.Scope{http.MethodPost: models.ScopeNotificationsWrite},
+		func(w http.ResponseWriter, r *http.Request) {
+			seen, _ = APIKeyFrom(r.Context())
+		})
+
+	claims := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   "jorbites",
+			"aud":   "jorbites-notifier",
+			"sub":   "jorbites-web",
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"scope": "notifications:write notifications:read",
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		return c
+	}
+	hs256 := func(c jwt.MapClaims, secret string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(secret))
+		return token
+	}
+	rs256 := func(c jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+		token.Header["kid"] = kid
+		signed, _ := token.SignedString(rsaKey)
+		return signed
+	}
+	// An attacker who knows the public key must not be able to use it as
+	// an HMAC secret.
+	publicKeyAsSecret := hs256(claims(nil), string(jwks))
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"HS256", hs256(claims(nil), "shared-secret"), 200},
+		{"RS256", rs256(claims(nil), "backend-1"), 200},
+		{"scopes array", hs256(claims(func(c jwt.MapClaims) { delete(c, "scope"); c["scopes"] = []string{"admin"} }), "shared-secret"), 200},
+		{"wrong secret", hs256(claims(nil), "guess"), 401},
+		{"unknown kid", rs256(claims(nil), "backend-2"), 401},
+		{"public key as secret", publicKeyAsSecret, 401},
+		{"wrong issuer", hs256(claims(func(c jwt.MapClaims) { c["iss"] = "someone" }), "shared-secret"), 401},
+		{"wrong audience", hs256(claims(func(c jwt.MapClaims) { c["aud"] = "other-service" }), "shared-secret"), 401},
+		{"expired", hs256(claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }), "shared-secret"), 401},
+		{"no expiry", hs256(claims(func(c jwt.MapClaims) { delete(c, "exp") }), "shared-secret"), 401},
+		{"no subject", hs256(claims(func(c jwt.MapClaims) { delete(c, "sub") }), "shared-secret"), 401},
+		{"missing scope", hs256(claims(func(c jwt.MapClaims) { c["scope"] = "queue:read" }), "shared-secret"), 403},
+		{"unsigned", func() string {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return token
+		}(), 401},
+	}
+	for _, tt := range tests {
+		seen = models.APIKey{}
+		req := httptest.NewRequest(http.MethodPost, "/notifications", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d %s, want %d", tt.name, rec.Code, rec.Body.String(), tt.status)
+		}
+		if tt.status == 200 && seen.Name != "jwt:jorbites-web" {
+			t.Errorf("%s: handler saw credential %q", tt.name, seen.Name)
+		}
+		if tt.status == 401 && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+	}
+}
+
+func TestNewTokenVerifier(t *testing.T) {
+	if v, err := NewTokenVerifier(&config.Config{JWTAudience: "jorbites-notifier"}); v != nil || err != nil {
+		t.Errorf("without a secret or JWKS file: %v, %v, want bearer tokens disabled", v, err)
+	}
+	if _, err := NewTokenVerifier(&config.Config{JWTSecret: "s", JWTAudience: "jorbites-notifier"}); err == nil {
+		t.Error("accepted a configuration without JWT_ISSUER")
+	}
+	if _, err := NewTokenVerifier(&config.Config{JWTJWKSFile: "missing.json", JWTIssuer: "jorbites", JWTAudience: "a"}); err == nil {
+		t.Error("accepted a missing JWKS file")
+	}
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// ConfiguredKey is an entry of the API_KEYS environment variable.
+type ConfiguredKey struct {
+	Name      string         `json:"name"`
+	Key       string         `json:"key"`
+	Scopes    []models.Scope `json:"scopes"`
+	ExpiresAt *time.Time     `json:"expiresAt,omitempty"`
+	// SignedOnly keys are only accepted on signed requests, never in the
+	// X-API-Key header.
+	SignedOnly bool `json:"signedOnly,omitempty"`
+}
+
+// KeyRing holds the API keys accepted by the service: the ones configured in
+// the environment, plus the ones loaded from MongoDB when enabled. Several
+// keys can be valid at once, so a key can be rotated by adding the new one,
+// moving callers over and then removing or expiring the old one.
+type KeyRing struct {
+	mutex      sync.RWMutex
+	configured map[string]models.APIKey
+	loaded     map[string]models.APIKey
+	// Only configured keys can sign requests: MongoDB holds hashes, which
+	// can't verify a signature.
+	signers    map[string]string
+	signedOnly map[string]bool
+}
+
+// NewKeyRing reads the keys configured in API_KEYS (a JSON array of
+// ConfiguredKey) and API_KEY, which is kept as an admin key named "default".
+func NewKeyRing(cfg *config.Config) (*KeyRing, error) {
+	var configured []ConfiguredKey
+	if cfg.APIKeys != "" {
+		if err := json.Unmarshal([]byte(cfg.APIKeys), &configured); err != nil {
+			return nil, fmt.Errorf("parsing API_KEYS: %w", err)
+		}
+	}
+	if cfg.APIKey != "" {
+		configured = append(configured, ConfiguredKey{Name: "default", Key: cfg.APIKey, Scopes: []models.Scope{models.ScopeAdmin}})
+	}
+
+	ring := &KeyRing{
+		configured: map[string]models.APIKey{},
+		signers:    map[string]string{},
+		signedOnly: map[string]bool{},
+	}
+	names := map[string]bool{}
+	for _, key := range configured {
+		if key.Name == "" || key.Key == "" {
+			return nil, errors.New("every API key needs a name and a key")
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("API key name %q is used twice", key.Name)
+		}
+		if other, ok := ring.configured[HashKey(key.Key)]; ok {
+			return nil, fmt.Errorf("API keys %q and %q have the same key", other.Name, key.Name)
+		}
+		names[key.Name] = true
+		ring.configured[HashKey(key.Key)] = models.APIKey{
+			Name:      key.Name,
+			KeyHash:   HashKey(key.Key),
+			Scopes:    key.Scopes,
+			ExpiresAt: key.ExpiresAt,
+		}
+		ring.signers[key.Name] = key.Key
+		ring.signedOnly[key.Name] = key.SignedOnly
+	}
+	return ring, nil
+}
+
+// HashKey returns the hex-encoded SHA-256 hash under which a key is stored.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the API key matching the presented secret. Keys that only
+// sign requests are not returned.
+func (k *KeyRing) Lookup(secret string) (models.APIKey, bool) {
+	hash := HashKey(secret)
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if key, ok := k.configured[hash]; ok {
+		return key, !k.signedOnly[key.Name]
+	}
+	key, ok := k.loaded[hash]
+	return key, ok
+}
+
+// Signer returns the configured key called name and the secret it signs
+// requests with.
+func (k *KeyRing) Signer(name string) (models.APIKey, string, bool) {
+	secret, ok := k.signers[name]
+	if !ok {
+		return models.APIKey{}, "", false
+	}
+	return k.configured[HashKey(secret)], secret, true
+}
+
+// Len returns how many keys are currently accepted.
+func (k *KeyRing) Len() int {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return len(k.configured) + len(k.loaded)
+}
+
+// Load replaces the keys loaded from outside the environment. A key that
+// shares its name or its secret with another one would take over that key's
+// identity, so if any does the whole set is rejected and the previous keys
+// stay in use.
+func (k *KeyRing) Load(keys []models.APIKey) error {
+	loaded := make(map[string]models.APIKey, len(keys))
+	names := map[string]bool{}
+	for _, key := range keys {
+		if key.Name == "" || key.KeyHash == "" {
+			return errors.New("every stored API key needs a name and a key hash")
+		}
+		// Every configured key is a signer.
+		if _, configured := k.signers[key.Name]; configured || names[key.Name] {
+			return fmt.Errorf("API key name %q is used twice", key.Name)
+		}
+		if other, ok := k.configured[key.KeyHash]; ok {
+			return fmt.Errorf("API keys %q and %q have the same key", other.Name, key.Name)
+		}
+		if other, ok := loaded[key.KeyHash]; ok {
+			return fmt.Errorf("API keys %q and %q have the same key", other.Name, key.Name)
+		}
+		names[key.Name] = true
+		loaded[key.KeyHash] = key
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.loaded = loaded
+	return nil
+}
+
+// Watch loads keys with load now and then every interval until ctx is done,
+// so keys added to or removed from MongoDB take effect without a restart. If
+// a reload fails the previous keys stay in use.
+func (k *KeyRing) Watch(ctx context.Context, load func(context.Context) ([]models.APIKey, error), interval time.Duration) error {
+	reload := func() error {
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		keys, err := load(loadCtx)
+		if err != nil {
+			return err
+		}
+		return k.Load(keys)
+	}
+
+	if err := reload(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := reload(); err != nil {
+					log.Printf("Error reloading API keys: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/database"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// HeaderSignature carries the signature of a signed request:
+// key=<key name>,t=<unix seconds>,nonce=<unique value>,v1=<hex HMAC-SHA256>.
+const HeaderSignature = "X-Jorbites-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid request signature")
+	ErrReplayedRequest  = errors.New("request was already received")
+)
+
+// NonceStore remembers the nonces of signed requests so each one is only
+// accepted once.
+type NonceStore interface {
+	// Use records nonce until expiresAt and reports whether it was unused.
+	Use(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// SignatureVerifier authenticates requests signed with a configured key
+// instead of sending the key itself, so a leaked request or log line can't
+// be reused: the signature covers the method, path, timestamp, nonce and
+// body, expires after maxSkew and is only accepted once.
+type SignatureVerifier struct {
+	keys    *KeyRing
+	nonces  NonceStore
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+func NewSignatureVerifier(keys *KeyRing, nonces NonceStore, maxSkew time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{
+		keys:    keys,
+		nonces:  nonces,
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// SignRequest returns the HeaderSignature value for a request to uri, the
+// path with its query string.
+func SignRequest(name string, secret string, method string, uri string, timestamp time.Time, nonce string, body []byte) string {
+	t := timestamp.Unix()
+	return fmt.Sprintf("key=%s,t=%d,nonce=%s,v1=%s", name, t, nonce, requestMAC(secret, method, uri, t, nonce, body))
+}
+
+// requestMAC signs the method, uri, timestamp, nonce and body, separated by
+// newlines.
+func requestMAC(secret string, method string, uri string, timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n", method, uri, timestamp, nonce)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of r and returns the key that signed it. The
+// body is read and replaced, so handlers can still decode it; a body cut off
+// by LimitBody fails with its *http.MaxBytesError.
+func (v *SignatureVerifier) Verify(r *http.Request) (models.APIKey, error) {
+	fields := map[string]string{}
+	for _, part := range strings.Split(r.Header.Get(HeaderSignature), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+	timestamp, err := strconv.ParseInt(fields["t"], 10, 64)
+	if err != nil || fields["key"] == "" || fields["nonce"] == "" || fields["v1"] == "" {
+		return models.APIKey{}, fmt.Errorf("%w: expected key, t, nonce and v1", ErrInvalidSignature)
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if skew := v.now().Sub(signedAt).Abs(); skew > v.maxSkew {
+		return models.APIKey{}, fmt.Errorf("%w: timestamp is %s away from the server clock", ErrInvalidSignature, skew.Round(time.Second))
+	}
+	key, secret, ok := v.keys.Signer(fields["key"])
+	if !ok {
+		return models.APIKey{}, fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, fields["key"])
+	}
+
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return models.APIKey{}, err
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%w: reading body: %v", ErrInvalidSignature, err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := requestMAC(secret, r.Method, r.URL.RequestURI(), timestamp, fields["nonce"], body)
+	if !hmac.Equal([]byte(expected), []byte(fields["v1"])) {
+		return models.APIKey{}, fmt.Errorf("%w: signature doesn't match", ErrInvalidSignature)
+	}
+
+	// A timestamp is accepted until maxSkew after it, so the nonce only
+	// needs to be remembered until then.
+	unused, err := v.nonces.Use(r.Context(), key.Name+":"+fields["nonce"], signedAt.Add(v.maxSkew))
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if !unused {
+		return models.APIKey{}, ErrReplayedRequest
+	}
+	return key, nil
+}
+
+// MemoryNonceStore keeps nonces in memory. It only protects a single
+// instance; use MongoNonceStore when several instances share the load.
+type MemoryNonceStore struct {
+	mutex     sync.Mutex
+	expiresAt map[string]time.Time
+	nextPrune time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{expiresAt: map[string]time.Time{}}
+}
+
+func (s *MemoryNonceStore) Use(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextPrune) {
+		for n, expiry := range s.expiresAt {
+			if now.After(expiry) {
+				delete(s.expiresAt, n)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+
+	if expiry, ok := s.expiresAt[nonce]; ok && !now.After(expiry) {
+		return false, nil
+	}
+	s.expiresAt[nonce] = expiresAt
+	return true, nil
+}
+
+// MongoNonceStore keeps nonces in the request_nonces collection, shared by
+// every instance.
+type MongoNonceStore struct {
+	db *database.MongoDB
+}
+
+func NewMongoNonceStore(ctx context.Context, db *database.MongoDB) (*MongoNonceStore, error) {
+	if err := db.EnsureRequestNonceIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return &MongoNonceStore{db: db}, nil
+}
+
+func (s *MongoNonceStore) Use(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	return s.db.UseRequestNonce(ctx, nonce, expiresAt)
+}
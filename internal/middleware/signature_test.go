@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestRequireSignature(t *testing.T) {
+	keys, err := NewKeyRing(&config.Config{
+		APIKeys: `[{"name":"backend","key":"secret","scopes":["notifications:write"],"signedOnly":true}]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &Authenticator{Keys: keys, Signatures: NewSignatureVerifier(keys, NewMemoryNonceStore(), 5*time.Minute)}
+
+	var received string
+	handler := auth.Require(map[string]models.Scope{http.MethodPost: models.ScopeNotificationsWrite},
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		})
+
+	body := `{"type":"NEW_LIKE"}`
+	now := time.Now()
+	send := func(signature string, requestBody string) int {
+		req := httptest.NewRequest(http.MethodPost, "/notifications?dry=1", strings.NewReader(requestBody))
+		req.Header.Set(HeaderSignature, signature)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		body      string
+		status    int
+	}{
+		{"valid", SignRequest("backend", "secret", "POST", "/notifications?dry=1", now, "n1", []byte(body)), body, 200},
+		{"replayed", SignRequest("backend", "secret", "POST", "/notifications?dry=1", now, "n1", []byte(body)), body, 401},
+		{"tampered body", SignRequest("backend", "secret", "POST", "/notifications?dry=1", now, "n2", []byte(body)), `{"type":"NEW_RECIPE"}`, 401},
+		{"other path", SignRequest("backend", "secret", "POST", "/notifications", now, "n3", []byte(body)), body, 401},
+		{"wrong secret", SignRequest("backend", "guess", "POST", "/notifications?dry=1", now, "n4", []byte(body)), body, 401},
+		{"unknown key", SignRequest("other", "secret", "POST", "/notifications?dry=1", now, "n5", []byte(body)), body, 401},
+		{"too old", SignRequest("backend", "secret", "POST", "/notifications?dry=1", now.Add(-6*time.Minute), "n6", []byte(body)), body, 401},
+		{"too far ahead", SignRequest("backend", "secret", "POST", "/notifications?dry=1", now.Add(6*time.Minute), "n7", []byte(body)), body, 401},
+		{"malformed", "v1=abc", body, 401},
+	}
+	for _, tt := range tests {
+		received = ""
+		if status := send(tt.signature, tt.body); status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+		if tt.status == 200 && received != body {
+			t.Errorf("%s: handler read body %q, want %q", tt.name, received, body)
+		}
+	}
+
+	// A signed-only key can't be sent as is.
+	req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body))
+	req.Header.Set(HeaderAPIKey, "secret")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("signed-only key in %s: status %d, want 401", HeaderAPIKey, rec.Code)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	if ok, _ := store.Use(context.Background(), "a", time.Now().Add(time.Minute)); !ok {
+		t.Fatal("first use of a nonce was rejected")
+	}
+	if ok, _ := store.Use(context.Background(), "a", time.Now().Add(time.Minute)); ok {
+		t.Fatal("second use of a nonce was accepted")
+	}
+	store.Use(context.Background(), "b", time.Now().Add(-time.Second))
+	if ok, _ := store.Use(context.Background(), "b", time.Now().Add(time.Minute)); !ok {
+		t.Fatal("an expired nonce was not forgotten")
+	}
+}
+
+func TestRequireSignatureLimitsBody(t *testing.T) {
+	keys, err := NewKeyRing(&config.Config{APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &Authenticator{Keys: keys, Signatures: NewSignatureVerifier(keys, NewMemoryNonceStore(), 5*time.Minute)}
+	reached := false
+	handler := LimitBody(auth.Require(nil, func(w http.ResponseWriter, r *http.Request) { reached = true }))
+
+	req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(strings.Repeat("x", MaxBodyBytes+1)))
+	req.Header.Set(HeaderSignature, "key=default,t="+strconv.FormatInt(time.Now().Unix(), 10)+",nonce=n,v1=00")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || reached {
+		t.Errorf("oversized signed request = %d, reached handler %t, want 413", rec.Code, reached)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Scope grants an API key access to a group of endpoints.
+type Scope string
+
+const (
+	ScopeNotificationsWrite Scope = "notifications:write"
+	ScopeNotificationsRead  Scope = "notifications:read"
+	ScopeQueueRead          Scope = "queue:read"
+	// ScopeAdmin grants every scope, including replaying and purging dead
+	// letters.
+	ScopeAdmin Scope = "admin"
+)
+
+// APIKey is a named credential for the API. Only the SHA-256 hash of the key
+// is kept, so the api_keys collection never holds usable secrets.
+type APIKey struct {
+	Name      string     `json:"name" bson:"name"`
+	KeyHash   string     `json:"-" bson:"key_hash"`
+	Scopes    []Scope    `json:"scopes" bson:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expires_at,omitempty"`
+}
+
+// Allows reports whether the key grants scope.
+func (k APIKey) Allows(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the key can no longer be used at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
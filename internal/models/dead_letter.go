@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type DeadLetterReason string
+
+const (
+	DeadLetterRetriesExhausted DeadLetterReason = "retries_exhausted"
+	DeadLetterPermanentFailure DeadLetterReason = "permanent_failure"
+)
+
+// DeadLetter is a notification that could not be delivered and was taken out
+// of the queue so it can be inspected, replayed or purged.
+type DeadLetter struct {
+	ID           string           `json:"id" bson:"_id"`
+	Notification Notification     `json:"notification" bson:"notification"`
+	Reason       DeadLetterReason `json:"reason" bson:"reason"`
+	LastError    string           `json:"lastError" bson:"last_error"`
+	Attempts     []Attempt        `json:"attempts" bson:"attempts"`
+	FailedAt     time.Time        `json:"failedAt" bson:"failed_at"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelPush  Channel = "push"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryFailed  DeliveryStatus = "failed"
+	DeliverySkipped DeliveryStatus = "skipped"
+	// DeliveryDryRun is recorded instead of DeliverySent when a dry run
+	// would have sent the email or push.
+	DeliveryDryRun DeliveryStatus = "dry_run"
+)
+
+// DeliveryResult is the outcome of delivering a notification to one recipient
+// on one channel. Broadcasts produce one result per user and subscription.
+type DeliveryResult struct {
+	Channel        Channel        `json:"channel" bson:"channel"`
+	Status         DeliveryStatus `json:"status" bson:"status"`
+	Recipient      string         `json:"recipient,omitempty" bson:"recipient,omitempty"`
+	UserID         string         `json:"userId,omitempty" bson:"user_id,omitempty"`
+	SubscriptionID string         `json:"subscriptionId,omitempty" bson:"subscription_id,omitempty"`
+	Language       string         `json:"language,omitempty" bson:"language,omitempty"`
+	// Title is the email subject or push title. It is only recorded for dry
+	// runs.
+	Title string    `json:"title,omitempty" bson:"title,omitempty"`
+	Error string    `json:"error,omitempty" bson:"error,omitempty"`
+	At    time.Time `json:"at" bson:"at"`
+}
+
+type ChannelSummary struct {
+	Sent    int `json:"sent" bson:"sent"`
+	Failed  int `json:"failed" bson:"failed"`
+	Skipped int `json:"skipped" bson:"skipped"`
+	DryRun  int `json:"dryRun,omitempty" bson:"dry_run,omitempty"`
+}
+
+// DeliveryReport collects the per-channel outcomes of processing a
+// notification.
+type DeliveryReport struct {
+	Email   ChannelSummary   `json:"email" bson:"email"`
+	Push    ChannelSummary   `json:"push" bson:"push"`
+	Results []DeliveryResult `json:"results" bson:"results"`
+}
+
+func (r *DeliveryReport) Add(result DeliveryResult) {
+	summary := &r.Email
+	if result.Channel == ChannelPush {
+		summary = &r.Push
+	}
+	switch result.Status {
+	case DeliverySent:
+		summary.Sent++
+	case DeliveryFailed:
+		summary.Failed++
+	case DeliverySkipped:
+		summary.Skipped++
+	case DeliveryDryRun:
+		summary.DryRun++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// Status derives the terminal status of a processed notification: sent when
+// nothing failed, failed when nothing was delivered, partially sent otherwise.
+// Dry-run deliveries count as delivered.
+func (r DeliveryReport) Status() NotificationStatus {
+	sent := r.Email.Sent + r.Push.Sent + r.Email.DryRun + r.Push.DryRun
+	failed := r.Email.Failed + r.Push.Failed
+	switch {
+	case failed == 0:
+		return StatusSent
+	case sent == 0:
+		return StatusFailed
+	default:
+		return StatusPartiallySent
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers the notification created for an idempotency
+// key until ExpiresAt, and a fingerprint of the request that created it.
+type IdempotencyRecord struct {
+	Key          string       `bson:"_id"`
+	Notification Notification `bson:"notification"`
+	Fingerprint  string       `bson:"fingerprint,omitempty"`
+	CreatedAt    time.Time    `bson:"created_at"`
+	ExpiresAt    time.Time    `bson:"expires_at"`
+}
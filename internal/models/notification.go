@@ -1,12 +1,31 @@
 package models
 
+import "time"
+
 type NotificationStatus string
 
 const (
-	StatusPending    NotificationStatus = "pending"
-	StatusProcessing NotificationStatus = "processing"
+	StatusPending       NotificationStatus = "pending"
+	StatusProcessing    NotificationStatus = "processing"
+	StatusSent          NotificationStatus = "sent"
+	StatusPartiallySent NotificationStatus = "partially_sent"
+	StatusFailed        NotificationStatus = "failed"
+	StatusCancelled     NotificationStatus = "cancelled"
+	// StatusDryRun marks a dry-run notification that was processed without
+	// anything being sent.
+	StatusDryRun NotificationStatus = "dry_run"
 )
 
+// Terminal reports whether a notification in this status is done and will not
+// be processed again.
+func (s NotificationStatus) Terminal() bool {
+	switch s {
+	case StatusSent, StatusPartiallySent, StatusFailed, StatusCancelled, StatusDryRun:
+		return true
+	}
+	return false
+}
+
 type NotificationType string
 
 const (
@@ -26,10 +45,88 @@ const (
 	TypeVerified               NotificationType = "VERIFIED"
 )
 
+// NotificationTypes lists every supported notification type.
+var NotificationTypes = []NotificationType{
+	TypeNewComment,
+	TypeNewLike,
+	TypeNewRecipe,
+	TypeNotificationsActivated,
+	TypeForgotPassword,
+	TypeMentionInComment,
+	TypeNewBlog,
+	TypeNewEvent,
+	TypeEventEndingSoon,
+	TypeNewQuest,
+	TypeQuestFulfilled,
+	TypeNewChallenge,
+	TypeNewBadge,
+	TypeVerified,
+}
+
 type Notification struct {
-	ID        string             `json:"id,omitempty"`
-	Type      NotificationType   `json:"type"`
-	Status    NotificationStatus `json:"status"`
-	Recipient string             `json:"recipient,omitempty"`
-	Metadata  map[string]string  `json:"metadata,omitempty"`
+	ID        string             `json:"id,omitempty" bson:"_id"`
+	Type      NotificationType   `json:"type" bson:"type"`
+	Status    NotificationStatus `json:"status" bson:"status"`
+	Recipient string             `json:"recipient,omitempty" bson:"recipient,omitempty"`
+	Metadata  map[string]string  `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	Priority  Priority           `json:"priority,omitempty" bson:"priority"`
+	CreatedAt time.Time          `json:"createdAt" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updated_at"`
+
+	// IdempotencyKey deduplicates retried requests: a notification enqueued
+	// with a key already seen within the idempotency window is not queued again.
+	IdempotencyKey string `json:"idempotencyKey,omitempty" bson:"idempotency_key,omitempty"`
+	// Owner names the API key that enqueued the notification. Idempotency
+	// keys are scoped to it, so clients never see each other's notifications.
+	Owner string `json:"-" bson:"owner,omitempty"`
+
+	// SendAt holds the notification back until the given time. DelaySeconds
+	// is an alternative relative form, resolved into SendAt on enqueue.
+	SendAt       *time.Time `json:"sendAt,omitempty" bson:"send_at,omitempty"`
+	DelaySeconds int        `json:"delaySeconds,omitempty" bson:"-"`
+
+	// DryRun processes the notification as usual, including user and
+	// subscription lookups and template rendering, but sends nothing. The
+	// delivery report then lists who would have received what.
+	DryRun bool `json:"dryRun,omitempty" bson:"dry_run,omitempty"`
+
+	// CallbackURL receives the delivery-result callback for this notification
+	// instead of the configured WEBHOOK_URL.
+	CallbackURL string `json:"callbackUrl,omitempty" bson:"callback_url,omitempty"`
+
+	// Retry state. Attempts counts how many times processing has started;
+	// NextAttemptAt holds back a failed notification until its backoff ends.
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty" bson:"next_attempt_at,omitempty"`
+	LastError     string     `json:"lastError,omitempty" bson:"last_error,omitempty"`
+	History       []Attempt  `json:"history,omitempty" bson:"history,omitempty"`
+
+	// Lifecycle records every status change. Once the notification reaches a
+	// terminal status it is kept, with its delivery report, until ExpiresAt.
+	Lifecycle   []StatusChange  `json:"lifecycle,omitempty" bson:"lifecycle,omitempty"`
+	Delivery    *DeliveryReport `json:"delivery,omitempty" bson:"delivery,omitempty"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   *time.Time      `json:"-" bson:"expires_at,omitempty"`
+
+	// Lease fields are set while a worker owns the notification. A lease that
+	// expires without being completed makes the notification claimable again.
+	LeaseOwner     string     `json:"leaseOwner,omitempty" bson:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty" bson:"lease_expires_at,omitempty"`
+}
+
+// Attempt records the outcome of one failed processing attempt.
+type Attempt struct {
+	Number     int       `json:"number" bson:"number"`
+	StartedAt  time.Time `json:"startedAt" bson:"started_at"`
+	FinishedAt time.Time `json:"finishedAt" bson:"finished_at"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	// Interrupted attempts were stopped by a shutdown; they are given back
+	// and don't count toward the attempt limit.
+	Interrupted bool `json:"interrupted,omitempty" bson:"interrupted,omitempty"`
+}
+
+type StatusChange struct {
+	Status NotificationStatus `json:"status" bson:"status"`
+	At     time.Time          `json:"at" bson:"at"`
+	Detail string             `json:"detail,omitempty" bson:"detail,omitempty"`
 }
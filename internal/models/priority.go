@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Priority decides the order in which pending notifications are claimed. The
+// zero value means "not set" and is replaced by the type's default priority
+// when the notification is enqueued.
+type Priority int
+
+const (
+	PriorityLow    Priority = 1
+	PriorityNormal Priority = 2
+	PriorityHigh   Priority = 3
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+// DefaultPriority returns the priority used when a notification doesn't set
+// one: transactional mail first, broadcasts last.
+func DefaultPriority(notificationType NotificationType) Priority {
+	switch notificationType {
+	case TypeForgotPassword, TypeVerified:
+		return PriorityHigh
+	case TypeNewRecipe, TypeNewBlog, TypeNewEvent, TypeEventEndingSoon, TypeNewQuest, TypeNewChallenge:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+func (p Priority) Valid() bool {
+	_, ok := priorityNames[p]
+	return ok
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON accepts the priority name ("low", "normal", "high").
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("priority must be one of low, normal, high")
+	}
+	for priority, priorityName := range priorityNames {
+		if name == priorityName {
+			*p = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid priority %q: must be one of low, normal, high", name)
+}
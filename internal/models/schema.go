@@ -0,0 +1,291 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MetadataFormat describes the values accepted for a metadata key.
+type MetadataFormat string
+
+const (
+	// FormatText accepts any non-empty string.
+	FormatText MetadataFormat = "text"
+	// FormatObjectID accepts a 24-character hex MongoDB ObjectID.
+	FormatObjectID MetadataFormat = "objectId"
+	// FormatObjectIDList accepts a comma-separated list of ObjectIDs.
+	FormatObjectIDList MetadataFormat = "objectIdList"
+	// FormatURL accepts an absolute http or https URL.
+	FormatURL MetadataFormat = "url"
+)
+
+type MetadataField struct {
+	Key         string         `json:"key"`
+	Format      MetadataFormat `json:"format"`
+	Description string         `json:"description"`
+	Example     string         `json:"example"`
+}
+
+// Audience describes who receives a notification.
+type Audience string
+
+const (
+	// AudienceRecipient is the user whose email is the notification's
+	// recipient.
+	AudienceRecipient Audience = "recipient"
+	// AudienceMentionedUsers are the users listed in the mentionedUsers
+	// metadata.
+	AudienceMentionedUsers Audience = "mentioned_users"
+	// AudienceBroadcast is every user with notifications enabled and every
+	// push subscription.
+	AudienceBroadcast Audience = "broadcast"
+)
+
+// NotificationSchema declares what a client must send for a notification
+// type to be processed correctly, and who it is delivered to.
+type NotificationSchema struct {
+	Type              NotificationType `json:"type"`
+	Description       string           `json:"description"`
+	Audience          Audience         `json:"audience"`
+	Channels          []Channel        `json:"channels"`
+	RecipientRequired bool             `json:"recipientRequired"`
+	Required          []MetadataField  `json:"requiredMetadata"`
+	Optional          []MetadataField  `json:"optionalMetadata"`
+}
+
+// Example returns a notification of this type that passes validation.
+func (s NotificationSchema) Example() Notification {
+	example := Notification{Type: s.Type}
+	if s.RecipientRequired {
+		example.Recipient = "user@example.com"
+	}
+	if len(s.Required)+len(s.Optional) > 0 {
+		example.Metadata = make(map[string]string)
+		for _, field := range append(append([]MetadataField{}, s.Required...), s.Optional...) {
+			example.Metadata[field.Key] = field.Example
+		}
+	}
+	return example
+}
+
+// ValidationProblem is one reason why a notification was rejected.
+type ValidationProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var (
+	fieldRecipeID       = MetadataField{Key: "recipeId", Format: FormatObjectID, Description: "ID of the recipe", Example: "65a1b2c3d4e5f6a7b8c9d0e1"}
+	fieldAuthorName     = MetadataField{Key: "authorName", Format: FormatText, Description: "Name of the comment author", Example: "User1"}
+	fieldUserID         = MetadataField{Key: "userId", Format: FormatObjectID, Description: "ID of the recipient; filled in from the recipient when omitted", Example: "65a1b2c3d4e5f6a7b8c9d0c1"}
+	fieldEventID        = MetadataField{Key: "eventId", Format: FormatText, Description: "ID of the event", Example: "summer-cooking-event"}
+	fieldEventTitle     = MetadataField{Key: "title", Format: FormatText, Description: "Title of the event", Example: "Summer Cooking Event"}
+	fieldQuestID        = MetadataField{Key: "questId", Format: FormatObjectID, Description: "ID of the quest", Example: "65a1b2c3d4e5f6a7b8c9d0a1"}
+	fieldMentionedUsers = MetadataField{Key: "mentionedUsers", Format: FormatObjectIDList, Description: "Comma-separated IDs of the users mentioned in the comment", Example: "65a1b2c3d4e5f6a7b8c9d0f1,65a1b2c3d4e5f6a7b8c9d0f2"}
+)
+
+var (
+	emailAndPush = []Channel{ChannelEmail, ChannelPush}
+	emailOnly    = []Channel{ChannelEmail}
+)
+
+var schemas = map[NotificationType]NotificationSchema{
+	TypeNewComment: {
+		Description:       "Sent to the author of a recipe when someone comments on it.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+		Required:          []MetadataField{fieldRecipeID, fieldAuthorName},
+		Optional: []MetadataField{
+			{Key: "commentId", Format: FormatObjectID, Description: "ID of the new comment", Example: "65a1b2c3d4e5f6a7b8c9d0e2"},
+		},
+	},
+	TypeNewLike: {
+		Description:       "Sent to the author of a recipe when someone likes it.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+		Required: []MetadataField{
+			fieldRecipeID,
+			{Key: "likedBy", Format: FormatText, Description: "Name of the user who liked the recipe", Example: "User2"},
+		},
+	},
+	TypeNewRecipe: {
+		Description: "Announces a newly published recipe.",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required:    []MetadataField{fieldRecipeID},
+		Optional: []MetadataField{
+			{Key: "recipeName", Format: FormatText, Description: "Name of the recipe, shown in the push notification", Example: "Tortilla de patatas"},
+			{Key: "slug", Format: FormatText, Description: "Slug of the recipe, used in the push notification link instead of its ID", Example: "tortilla-de-patatas"},
+		},
+	},
+	TypeNotificationsActivated: {
+		Description:       "Confirms that a user activated notifications.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+	},
+	TypeForgotPassword: {
+		Description:       "Sends a password reset link. Always emailed, even if the user disabled email notifications.",
+		Audience:          AudienceRecipient,
+		Channels:          emailOnly,
+		RecipientRequired: true,
+		Required: []MetadataField{
+			{Key: "resetUrl", Format: FormatURL, Description: "Link to the password reset page", Example: "https://jorbites.com/reset-password?token=abc123"},
+		},
+	},
+	TypeMentionInComment: {
+		Description: "Sent to the users mentioned in a comment, except its author.",
+		Audience:    AudienceMentionedUsers,
+		Channels:    emailAndPush,
+		Required:    []MetadataField{fieldMentionedUsers, fieldAuthorName, fieldRecipeID},
+	},
+	TypeNewBlog: {
+		Description: "Announces a new blog post.",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required: []MetadataField{
+			{Key: "blog_id", Format: FormatText, Description: "ID of the blog post", Example: "new-features-2025"},
+		},
+		Optional: []MetadataField{
+			{Key: "title", Format: FormatText, Description: "Title of the blog post, shown in the push notification", Example: "New features in Jorbites"},
+		},
+	},
+	TypeNewEvent: {
+		Description: "Announces a new event.",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required:    []MetadataField{fieldEventID, fieldEventTitle},
+	},
+	TypeEventEndingSoon: {
+		Description: "Reminds users that an event ends in 3 days.",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required:    []MetadataField{fieldEventID, fieldEventTitle},
+	},
+	TypeNewQuest: {
+		Description: "Announces a new quest (recipe request).",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required:    []MetadataField{fieldQuestID},
+	},
+	TypeQuestFulfilled: {
+		Description:       "Sent to the requestor of a quest when someone fulfills it.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+		Required: []MetadataField{
+			fieldQuestID,
+			{Key: "fulfilledByName", Format: FormatText, Description: "Name of the user who fulfilled the quest", Example: "User2"},
+		},
+		Optional: []MetadataField{
+			{Key: "submissionId", Format: FormatObjectID, Description: "ID of the submission", Example: "65a1b2c3d4e5f6a7b8c9d0b1"},
+		},
+	},
+	TypeNewChallenge: {
+		Description: "Announces the Challenge of the Week.",
+		Audience:    AudienceBroadcast,
+		Channels:    emailAndPush,
+		Required: []MetadataField{
+			{Key: "title", Format: FormatText, Description: "Title of the challenge", Example: "Reto de Ingrediente"},
+			{Key: "description", Format: FormatText, Description: "Description of the challenge with the value already interpolated", Example: "Esta semana el ingrediente estrella es el tomate."},
+		},
+	},
+	TypeNewBadge: {
+		Description:       "Sent to a user who earned a badge.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+		Required: []MetadataField{
+			{Key: "badgeName", Format: FormatText, Description: "Name or ID of the badge, e.g. level_100", Example: "level_100"},
+		},
+		Optional: []MetadataField{fieldUserID},
+	},
+	TypeVerified: {
+		Description:       "Sent to a user whose account became verified after posting 30 recipes.",
+		Audience:          AudienceRecipient,
+		Channels:          emailAndPush,
+		RecipientRequired: true,
+		Optional:          []MetadataField{fieldUserID},
+	},
+}
+
+func init() {
+	for notificationType, schema := range schemas {
+		schema.Type = notificationType
+		if schema.Required == nil {
+			schema.Required = []MetadataField{}
+		}
+		if schema.Optional == nil {
+			schema.Optional = []MetadataField{}
+		}
+		schemas[notificationType] = schema
+	}
+}
+
+// SchemaFor returns the schema of a notification type, and false when the
+// type is not supported.
+func SchemaFor(notificationType NotificationType) (NotificationSchema, bool) {
+	schema, ok := schemas[notificationType]
+	return schema, ok
+}
+
+// Validate checks the recipient and metadata of a notification against the
+// schema and returns every problem found. Metadata keys the schema doesn't
+// mention are ignored.
+func (s NotificationSchema) Validate(notification Notification) []ValidationProblem {
+	var problems []ValidationProblem
+
+	if s.RecipientRequired && strings.TrimSpace(notification.Recipient) == "" {
+		problems = append(problems, ValidationProblem{Field: "recipient", Message: "is required for " + string(s.Type)})
+	}
+
+	for _, field := range s.Required {
+		value, ok := notification.Metadata[field.Key]
+		if !ok || strings.TrimSpace(value) == "" {
+			problems = append(problems, ValidationProblem{Field: "metadata." + field.Key, Message: "is required"})
+			continue
+		}
+		if err := field.Format.Check(value); err != nil {
+			problems = append(problems, ValidationProblem{Field: "metadata." + field.Key, Message: err.Error()})
+		}
+	}
+
+	for _, field := range s.Optional {
+		value, ok := notification.Metadata[field.Key]
+		if !ok || value == "" {
+			continue
+		}
+		if err := field.Format.Check(value); err != nil {
+			problems = append(problems, ValidationProblem{Field: "metadata." + field.Key, Message: err.Error()})
+		}
+	}
+
+	return problems
+}
+
+// Check returns an error describing why value doesn't have the format.
+func (f MetadataFormat) Check(value string) error {
+	switch f {
+	case FormatObjectID:
+		if _, err := bson.ObjectIDFromHex(value); err != nil {
+			return fmt.Errorf("must be an ObjectID, got %q", value)
+		}
+	case FormatObjectIDList:
+		for _, id := range strings.Split(value, ",") {
+			if _, err := bson.ObjectIDFromHex(id); err != nil {
+				return fmt.Errorf("must be a comma-separated list of ObjectIDs, got %q", id)
+			}
+		}
+	case FormatURL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("must be an absolute http or https URL, got %q", value)
+		}
+	}
+	return nil
+}
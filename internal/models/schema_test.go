@@ -0,0 +1,92 @@
+package models
+
+import "testing"
+
+func TestEveryTypeHasASchema(t *testing.T) {
+	for _, notificationType := range NotificationTypes {
+		if _, ok := SchemaFor(notificationType); !ok {
+			t.Errorf("no schema for %s", notificationType)
+		}
+	}
+	if _, ok := SchemaFor("BOGUS"); ok {
+		t.Error("SchemaFor(BOGUS) found a schema")
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		notification Notification
+		fields       []string
+	}{
+		{
+			name: "valid like",
+			notification: Notification{Type: TypeNewLike, Recipient: "user@example.com", Metadata: map[string]string{
+				"recipeId": "65a1b2c3d4e5f6a7b8c9d0e1",
+				"likedBy":  "User2",
+			}},
+		},
+		{
+			name:         "like without recipient or metadata",
+			notification: Notification{Type: TypeNewLike},
+			fields:       []string{"recipient", "metadata.recipeId", "metadata.likedBy"},
+		},
+		{
+			name: "malformed recipe ID",
+			notification: Notification{Type: TypeNewRecipe, Metadata: map[string]string{
+				"recipeId": "67890",
+			}},
+			fields: []string{"metadata.recipeId"},
+		},
+		{
+			name: "reset URL without scheme",
+			notification: Notification{Type: TypeForgotPassword, Recipient: "user@example.com", Metadata: map[string]string{
+				"resetUrl": "example.com/reset",
+			}},
+			fields: []string{"metadata.resetUrl"},
+		},
+		{
+			name: "mention list with an invalid ID",
+			notification: Notification{Type: TypeMentionInComment, Metadata: map[string]string{
+				"mentionedUsers": "65a1b2c3d4e5f6a7b8c9d0e1,user2",
+				"authorName":     "User3",
+				"recipeId":       "65a1b2c3d4e5f6a7b8c9d0e1",
+			}},
+			fields: []string{"metadata.mentionedUsers"},
+		},
+		{
+			name: "malformed optional field",
+			notification: Notification{Type: TypeVerified, Recipient: "user@example.com", Metadata: map[string]string{
+				"userId": "12345",
+			}},
+			fields: []string{"metadata.userId"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, _ := SchemaFor(tt.notification.Type)
+			problems := schema.Validate(tt.notification)
+			if len(problems) != len(tt.fields) {
+				t.Fatalf("Validate() = %+v, want problems for %v", problems, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if problems[i].Field != field {
+					t.Errorf("problem %d is for %s, want %s", i, problems[i].Field, field)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaExamplesAreValid(t *testing.T) {
+	for _, notificationType := range NotificationTypes {
+		schema, _ := SchemaFor(notificationType)
+		if problems := schema.Validate(schema.Example()); len(problems) > 0 {
+			t.Errorf("example for %s is invalid: %+v", notificationType, problems)
+		}
+		if len(schema.Channels) == 0 || schema.Audience == "" {
+			t.Errorf("schema for %s doesn't declare its channels and audience", notificationType)
+		}
+	}
+}
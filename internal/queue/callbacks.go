@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/webhook"
+)
+
+// callbackSender delivers delivery-result callbacks; webhook.Sender in
+// production.
+type callbackSender interface {
+	Send(ctx context.Context, url string, deliveryID string, payload webhook.Payload) error
+}
+
+// CallbackAllowed reports whether a notification may have url as its
+// callback URL.
+func (q *Queue) CallbackAllowed(url string) bool {
+	return q.callbackHosts.Allows(url)
+}
+
+// sendCallback reports the outcome of a processed notification to its
+// callback URL, or to the configured webhook URL. Callbacks are retried with
+// their own backoff in the background and never hold up the queue. They are
+// kept in memory only: retries still pending when the service stops are
+// dropped. Dry runs send nothing, callbacks included.
+func (q *Queue) sendCallback(notification models.Notification, status models.NotificationStatus, report *models.DeliveryReport, lastError string) {
+	if notification.DryRun || q.dryRun {
+		return
+	}
+	url := notification.CallbackURL
+	if url == "" {
+		url = q.webhookURL
+	} else if !q.CallbackAllowed(url) {
+		// Notifications enqueued before the host was removed from the list,
+		// or replayed from dead letters, may still carry it.
+		log.Printf("Callback for notification %s skipped: %s is not on an allowed host", notification.ID, url)
+		return
+	}
+	if url == "" {
+		return
+	}
+	if q.callbacks == nil {
+		log.Printf("Callback for notification %s skipped: WEBHOOK_SECRET is not set", notification.ID)
+		return
+	}
+
+	payload := webhook.Payload{
+		Event:          webhook.EventNotificationCompleted,
+		NotificationID: notification.ID,
+		Type:           notification.Type,
+		Status:         status,
+		Recipient:      notification.Recipient,
+		Attempts:       notification.Attempts,
+		Error:          lastError,
+		Delivery:       webhook.Summarize(report),
+		CompletedAt:    time.Now().UTC(),
+	}
+	deliveryID := uuid.New().String()
+
+	q.pendingCallbacks.Add(1)
+	go func() {
+		defer q.pendingCallbacks.Done()
+		q.deliverCallback(url, deliveryID, payload)
+	}()
+}
+
+func (q *Queue) deliverCallback(url string, deliveryID string, payload webhook.Payload) {
+	for attempt := 1; ; attempt++ {
+		err := q.callbacks.Send(context.Background(), url, deliveryID, payload)
+		if err == nil {
+			log.Printf("Callback %s for notification %s delivered", deliveryID, payload.NotificationID)
+			return
+		}
+
+		var statusErr *webhook.StatusError
+		if errors.As(err, &statusErr) && !statusErr.Retryable() {
+			log.Printf("Callback %s for notification %s rejected: %v", deliveryID, payload.NotificationID, err)
+			return
+		}
+		if attempt >= q.callbackRetry.MaxAttempts {
+			log.Printf("Callback %s for notification %s failed after %d attempts: %v", deliveryID, payload.NotificationID, attempt, err)
+			return
+		}
+
+		delay := q.callbackRetry.Delay(attempt)
+		log.Printf("Callback %s for notification %s failed: %v. Retrying in %s", deliveryID, payload.NotificationID, err, delay.Round(time.Second))
+		select {
+		case <-time.After(delay):
+		case <-q.stopping:
+			log.Printf("Callback %s for notification %s dropped by shutdown", deliveryID, payload.NotificationID)
+			return
+		}
+	}
+}
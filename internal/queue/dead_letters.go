@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+var ErrNotFound = errors.New("notification not found")
+
+// deadLetter copies a notification that will not be retried into the
+// dead-letter store, with its delivery report, and marks the job failed, or
+// partially sent if report shows some deliveries went out. A nil report
+// keeps the one saved by earlier attempts. If the dead letter can't be saved the job is
+// left in the queue so its lease expires and it is dead-lettered again later.
+// If another worker has claimed the job in the meantime, the dead letter is
+// withdrawn and the job left to that worker.
+func (q *Queue) deadLetter(notification models.Notification, reason models.DeadLetterReason, last models.Attempt, report *models.DeliveryReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner := notification.LeaseOwner
+	if report == nil {
+		report = notification.Delivery
+	}
+	attempts := append(append([]models.Attempt{}, notification.History...), last)
+	notification.History = nil
+	notification.Lifecycle = nil
+	notification.Delivery = report
+	notification.LeaseOwner = ""
+	notification.LeaseExpiresAt = nil
+
+	deadLetter := models.DeadLetter{
+		ID:           notification.ID,
+		Notification: notification,
+		Reason:       reason,
+		LastError:    last.Error,
+		Attempts:     attempts,
+		FailedAt:     last.FinishedAt,
+	}
+
+	if err := q.deadLetters.Add(ctx, deadLetter); err != nil {
+		log.Printf("Error moving notification %s to dead letters: %v", notification.ID, err)
+		return
+	}
+	status := models.StatusFailed
+	if report != nil && report.Status() == models.StatusPartiallySent {
+		status = models.StatusPartiallySent
+	}
+	if err := q.store.Complete(ctx, notification.ID, owner, status, report, time.Now().UTC().Add(q.retention)); err != nil {
+		log.Printf("Error completing dead-lettered notification %s: %v", notification.ID, err)
+		if errors.Is(err, ErrLeaseLost) {
+			if _, err := q.deadLetters.Delete(ctx, deadLetter.ID); err != nil {
+				log.Printf("Error withdrawing dead letter %s: %v", deadLetter.ID, err)
+			}
+		}
+		return
+	}
+	log.Printf("Notification %s moved to dead letters (%s)", notification.ID, reason)
+	q.events.Publish(Event{
+		Type:             EventCompleted,
+		NotificationID:   notification.ID,
+		NotificationType: notification.Type,
+		Status:           status,
+		Attempt:          notification.Attempts,
+		Error:            last.Error,
+	})
+	q.sendCallback(notification, status, report, last.Error)
+}
+
+func (q *Queue) ListDeadLetters() ([]models.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return q.deadLetters.List(ctx)
+}
+
+// ReplayDeadLetter enqueues the notification held in a dead letter as a new
+// notification with a fresh attempt count, and removes the dead letter.
+// Recipients the notification was already delivered to are skipped.
+func (q *Queue) ReplayDeadLetter(id string) (models.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deadLetter, err := q.deadLetters.Get(ctx, id)
+	if err != nil {
+		return models.Notification{}, err
+	}
+	if deadLetter == nil {
+		return models.Notification{}, ErrNotFound
+	}
+
+	return q.replay(ctx, *deadLetter)
+}
+
+// ReplayDeadLetters replays every dead letter and returns the notifications
+// that were enqueued again.
+func (q *Queue) ReplayDeadLetters() ([]models.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	deadLetters, err := q.deadLetters.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := []models.Notification{}
+	for _, deadLetter := range deadLetters {
+		notification, err := q.replay(ctx, deadLetter)
+		if err != nil {
+			return replayed, err
+		}
+		replayed = append(replayed, notification)
+	}
+	return replayed, nil
+}
+
+// replay enqueues the notification of a dead letter again. It resumes from
+// the delivery report of the dead letter, so only the recipients that weren't
+// delivered to are sent to.
+func (q *Queue) replay(ctx context.Context, deadLetter models.DeadLetter) (models.Notification, error) {
+	original := deadLetter.Notification
+	// The key was used by the original request; keeping it would make the
+	// replay look like a duplicate.
+	original.IdempotencyKey = ""
+
+	notification, err := q.enqueue(original, original.Delivery)
+	if err != nil {
+		return notification, err
+	}
+	if _, err := q.deadLetters.Delete(ctx, deadLetter.ID); err != nil {
+		return notification, err
+	}
+	log.Printf("Dead letter %s replayed as notification %s", deadLetter.ID, notification.ID)
+	return notification, nil
+}
+
+func (q *Queue) PurgeDeadLetter(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deleted, err := q.deadLetters.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (q *Queue) PurgeDeadLetters() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return q.deadLetters.Purge(ctx)
+}
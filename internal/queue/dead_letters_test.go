@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func likeRequest() models.Notification {
+	return models.Notification{
+		Type:           models.TypeNewLike,
+		Recipient:      "user@example.com",
+		Metadata:       map[string]string{"likedBy": "User2", "recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"},
+		IdempotencyKey: "like-1",
+	}
+}
+
+// deadLetteredLike enqueues a like whose email keeps failing and processes it
+// until it runs out of attempts.
+func deadLetteredLike(t *testing.T) (*Queue, models.Notification) {
+	t.Helper()
+	q, mailer, _ := newDeliveringQueue(models.User{ID: bson.NewObjectID(), Email: "user@example.com", EmailNotifications: true})
+	q.idempotencyTTL = time.Hour
+	q.retryPolicy = RetryPolicy{MaxAttempts: 2}
+	mailer.errs = []error{errors.New("smtp timeout"), errors.New("smtp timeout")}
+
+	n, err := q.Enqueue(likeRequest())
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if !q.processNextNotification("worker") {
+			t.Fatalf("attempt %d found nothing to process", i+1)
+		}
+	}
+	return q, n
+}
+
+func TestDeadLetterAfterRetriesRunOut(t *testing.T) {
+	q, n := deadLetteredLike(t)
+
+	deadLetters, _ := q.ListDeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(deadLetters))
+	}
+	deadLetter := deadLetters[0]
+	if deadLetter.ID != n.ID || deadLetter.Reason != models.DeadLetterRetriesExhausted || len(deadLetter.Attempts) != 2 || deadLetter.LastError == "" {
+		t.Errorf("dead letter = %+v, want notification %s with both attempts and the last error", deadLetter, n.ID)
+	}
+
+	// The push went out on the first attempt, so the notification is
+	// partially sent rather than failed.
+	got, _ := q.GetNotification(n.ID)
+	if got.Status != models.StatusPartiallySent || got.Delivery.Email.Failed != 1 || got.Delivery.Push.Sent != 1 {
+		t.Errorf("notification = %s %+v, want partially sent", got.Status, got.Delivery)
+	}
+	if q.processNextNotification("worker") {
+		t.Error("a dead-lettered notification was processed again")
+	}
+}
+
+func TestProcessDeadLettersNotificationsOverTheAttemptLimit(t *testing.T) {
+	q, mailer, _ := newDeliveringQueue(models.User{ID: bson.NewObjectID(), Email: "user@example.com", EmailNotifications: true})
+	q.retryPolicy = RetryPolicy{MaxAttempts: 1}
+
+	// The only attempt failed but couldn't be moved to the dead letters, so
+	// its lease expired.
+	q.Enqueue(likeRequest())
+	q.store.Claim(context.Background(), "worker", -time.Second, ClaimOldestFirst)
+
+	if !q.processNextNotification("worker") {
+		t.Fatal("processNextNotification() didn't claim the expired lease")
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("emails sent = %v, want none past the attempt limit", mailer.sent)
+	}
+	if deadLetters, _ := q.ListDeadLetters(); len(deadLetters) != 1 {
+		t.Errorf("dead letters = %d, want 1", len(deadLetters))
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	q, n := deadLetteredLike(t)
+
+	replayed, err := q.ReplayDeadLetter(n.ID)
+	if err != nil {
+		t.Fatalf("ReplayDeadLetter() error = %v", err)
+	}
+	if replayed.ID == n.ID || replayed.Status != models.StatusPending || replayed.Attempts != 0 || replayed.IdempotencyKey != "" {
+		t.Errorf("replayed notification = %+v, want a new pending notification with no attempts or idempotency key", replayed)
+	}
+	if replayed.Recipient != n.Recipient || replayed.Metadata["likedBy"] != "User2" {
+		t.Errorf("replayed notification = %+v, want the original recipient and metadata", replayed)
+	}
+	if deadLetters, _ := q.ListDeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("dead letters after replay = %d, want 0", len(deadLetters))
+	}
+	if _, err := q.ReplayDeadLetter(n.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReplayDeadLetter() twice error = %v, want ErrNotFound", err)
+	}
+
+	// The original key still answers with the original notification.
+	original, err := q.Enqueue(likeRequest())
+	if !errors.Is(err, ErrDuplicate) || original.ID != n.ID {
+		t.Errorf("Enqueue() with the original key = %s, %v, want the original notification", original.ID, err)
+	}
+}
+
+func TestReplayDeadLetterSkipsDeliveredRecipients(t *testing.T) {
+	q, n := deadLetteredLike(t)
+	mailer, pusher := q.emailSender.(*fakeMailer), q.pushSender.(*fakePusher)
+
+	deadLetters, _ := q.ListDeadLetters()
+	if delivery := deadLetters[0].Notification.Delivery; delivery == nil || delivery.Push.Sent != 1 {
+		t.Fatalf("dead letter delivery = %+v, want the push sent before it failed", delivery)
+	}
+
+	replayed, err := q.ReplayDeadLetter(n.ID)
+	if err != nil {
+		t.Fatalf("ReplayDeadLetter() error = %v", err)
+	}
+	q.processNextNotification("worker")
+
+	if len(mailer.sent) != 3 || len(pusher.sent) != 1 {
+		t.Errorf("after replay %d emails and %d pushes were attempted, want the failed email retried and no push resent", len(mailer.sent), len(pusher.sent))
+	}
+	got, _ := q.GetNotification(replayed.ID)
+	if got.Status != models.StatusSent || got.Delivery.Email.Sent != 1 || got.Delivery.Push.Sent != 1 {
+		t.Errorf("replayed notification = %s %+v, want sent with the earlier push", got.Status, got.Delivery)
+	}
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	q := newTestQueue()
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		q.deadLetters.Add(ctx, models.DeadLetter{ID: id, Notification: models.Notification{ID: id}})
+	}
+
+	if err := q.PurgeDeadLetter("a"); err != nil {
+		t.Fatalf("PurgeDeadLetter() error = %v", err)
+	}
+	if err := q.PurgeDeadLetter("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PurgeDeadLetter() twice error = %v, want ErrNotFound", err)
+	}
+
+	purged, err := q.PurgeDeadLetters()
+	if err != nil || purged != 2 {
+		t.Errorf("PurgeDeadLetters() = %d, %v, want 2", purged, err)
+	}
+	if deadLetters, _ := q.ListDeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("dead letters after purge = %d, want 0", len(deadLetters))
+	}
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// delivery collects the per-recipient results of processing one notification
+// and tracks the push goroutines it starts, so the notification is only
+// completed once every send has finished.
+// In a dry run nothing is sent and successful deliveries are recorded as
+// dry-run results.
+type delivery struct {
+	// ctx is cancelled when shutdown interrupts the notification; no sends
+	// start after that.
+	ctx    context.Context
+	dryRun bool
+	// onRecord, if set, is called with every result as it is recorded.
+	onRecord func(models.DeliveryResult)
+	mutex    sync.Mutex
+	report   models.DeliveryReport
+	// done holds the recipients earlier attempts delivered to, which are not
+	// sent to again.
+	done  map[string]bool
+	sends sync.WaitGroup
+}
+
+// newDelivery starts a delivery that carries over the successful results of
+// previous, the report saved by earlier attempts, if any.
+func newDelivery(ctx context.Context, dryRun bool, previous *models.DeliveryReport) *delivery {
+	d := &delivery{
+		ctx:    ctx,
+		dryRun: dryRun,
+		report: models.DeliveryReport{Results: []models.DeliveryResult{}},
+		done:   map[string]bool{},
+	}
+	if previous != nil {
+		for _, result := range previous.Results {
+			if result.Status == models.DeliverySent || result.Status == models.DeliveryDryRun {
+				d.report.Add(result)
+				d.done[deliveryKey(result)] = true
+			}
+		}
+	}
+	return d
+}
+
+// deliveryKey identifies who a result was delivered to: the email address for
+// emails and the subscription for pushes.
+func deliveryKey(result models.DeliveryResult) string {
+	if result.Channel == models.ChannelPush {
+		return "push:" + result.SubscriptionID
+	}
+	return "email:" + result.Recipient
+}
+
+// emailed reports whether an earlier attempt already emailed recipient.
+func (d *delivery) emailed(recipient string) bool {
+	return d.done[deliveryKey(models.DeliveryResult{Channel: models.ChannelEmail, Recipient: recipient})]
+}
+
+// unpushed returns the subscriptions earlier attempts haven't pushed to.
+func (d *delivery) unpushed(subs []models.PushSubscription) []models.PushSubscription {
+	var pending []models.PushSubscription
+	for _, sub := range subs {
+		if !d.done[deliveryKey(models.DeliveryResult{Channel: models.ChannelPush, SubscriptionID: sub.ID.Hex()})] {
+			pending = append(pending, sub)
+		}
+	}
+	if skipped := len(subs) - len(pending); skipped > 0 {
+		log.Printf("Skipping %d push subscriptions already sent to by an earlier attempt", skipped)
+	}
+	return pending
+}
+
+func (d *delivery) record(result models.DeliveryResult) {
+	if result.At.IsZero() {
+		result.At = time.Now().UTC()
+	}
+
+	d.mutex.Lock()
+	d.report.Add(result)
+	d.mutex.Unlock()
+
+	if d.onRecord != nil {
+		d.onRecord(result)
+	}
+}
+
+// recordError records a sent (or dry-run) result when err is nil and a failed
+// one otherwise.
+func (d *delivery) recordError(result models.DeliveryResult, err error) {
+	result.Status = models.DeliverySent
+	if d.dryRun {
+		result.Status = models.DeliveryDryRun
+	}
+	if err != nil {
+		result.Status = models.DeliveryFailed
+		result.Error = err.Error()
+	}
+	d.record(result)
+}
+
+// interrupted reports whether shutdown has stopped the delivery.
+func (d *delivery) interrupted() bool {
+	return d.ctx.Err() != nil
+}
+
+// send runs fn in its own goroutine, tracked by wait, unless the delivery has
+// been interrupted.
+func (d *delivery) send(fn func()) {
+	if d.interrupted() {
+		return
+	}
+	d.sends.Add(1)
+	go func() {
+		defer d.sends.Done()
+		fn()
+	}()
+}
+
+// wait blocks until every goroutine started with send has returned.
+func (d *delivery) wait() {
+	d.sends.Wait()
+}
+
+func (d *delivery) Report() models.DeliveryReport {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	report := d.report
+	report.Results = append([]models.DeliveryResult{}, d.report.Results...)
+	return report
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// depthCacheTTL bounds how stale Depth may be; counting a large queue on
+// every enqueue would cost more than the enqueue itself.
+const depthCacheTTL = time.Second
+
+type depthCache struct {
+	mutex     sync.Mutex
+	summary   Summary
+	countedAt time.Time
+}
+
+// Depth counts the pending and processing notifications, by status and type.
+// The store is counted at most once per second; notifications this instance
+// enqueues in between are added to the last count.
+func (q *Queue) Depth() (Summary, error) {
+	q.depth.mutex.Lock()
+	defer q.depth.mutex.Unlock()
+
+	if time.Since(q.depth.countedAt) >= depthCacheTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		summary, err := q.store.Summarize(ctx, ListFilter{})
+		if err != nil {
+			return Summary{}, err
+		}
+		q.depth.summary = summary
+		q.depth.countedAt = time.Now()
+	}
+
+	summary := q.depth.summary
+	summary.ByStatus = maps.Clone(summary.ByStatus)
+	summary.ByType = maps.Clone(summary.ByType)
+	return summary, nil
+}
+
+// countEnqueued adds notifications to the cached depth until the next count.
+func (q *Queue) countEnqueued(notifications []models.Notification) {
+	q.depth.mutex.Lock()
+	defer q.depth.mutex.Unlock()
+
+	if q.depth.countedAt.IsZero() {
+		return
+	}
+	for _, notification := range notifications {
+		q.depth.summary.add(notification.Status, notification.Type, 1)
+	}
+}
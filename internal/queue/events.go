@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+type EventType string
+
+const (
+	EventEnqueued   EventType = "enqueued"
+	EventProcessing EventType = "processing"
+	EventDelivery   EventType = "delivery"
+	EventRetry      EventType = "retry"
+	EventCompleted  EventType = "completed"
+	EventCancelled  EventType = "cancelled"
+)
+
+// Event describes something that happened to a notification. Delivery events
+// carry one per-channel result; completion events carry the terminal status.
+type Event struct {
+	ID               uint64                    `json:"id"`
+	Type             EventType                 `json:"event"`
+	NotificationID   string                    `json:"notificationId"`
+	NotificationType models.NotificationType   `json:"type"`
+	Status           models.NotificationStatus `json:"status,omitempty"`
+	Attempt          int                       `json:"attempt,omitempty"`
+	Delivery         *models.DeliveryResult    `json:"delivery,omitempty"`
+	Error            string                    `json:"error,omitempty"`
+	At               time.Time                 `json:"at"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const subscriberBuffer = 256
+
+type subscriber struct {
+	events chan Event
+	types  map[models.NotificationType]bool
+}
+
+// EventBus fans queue events out to subscribers such as the SSE stream.
+// Publishing never blocks: a subscriber that can't keep up misses events.
+type EventBus struct {
+	mutex       sync.Mutex
+	nextID      uint64
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns a channel receiving every event for the given types, or
+// for all types when none are given, and a function that ends the
+// subscription. The channel is closed when the bus is closed.
+func (b *EventBus) Subscribe(types []models.NotificationType) (<-chan Event, func()) {
+	s := &subscriber{events: make(chan Event, subscriberBuffer)}
+	if len(types) > 0 {
+		s.types = make(map[models.NotificationType]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		close(s.events)
+		return s.events, func() {}
+	}
+	b.subscribers[s] = struct{}{}
+
+	return s.events, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[s]; ok {
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+func (b *EventBus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextID++
+	event.ID = b.nextID
+	for s := range b.subscribers {
+		if s.types != nil && !s.types[event.NotificationType] {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription so open streams finish, e.g. on shutdown.
+func (b *EventBus) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestEventBusFiltersByType(t *testing.T) {
+	q := newTestQueue()
+
+	all, unsubscribeAll := q.Events().Subscribe(nil)
+	defer unsubscribeAll()
+	likes, unsubscribeLikes := q.Events().Subscribe([]models.NotificationType{models.TypeNewLike})
+	defer unsubscribeLikes()
+
+	comment, _ := q.Enqueue(models.Notification{Type: models.TypeNewComment})
+	like, _ := q.Enqueue(models.Notification{Type: models.TypeNewLike})
+
+	for _, want := range []string{comment.ID, like.ID} {
+		event := <-all
+		if event.Type != EventEnqueued || event.NotificationID != want {
+			t.Errorf("unfiltered event = %+v, want enqueued %s", event, want)
+		}
+	}
+
+	event := <-likes
+	if event.NotificationID != like.ID || event.NotificationType != models.TypeNewLike {
+		t.Errorf("filtered event = %+v, want enqueued %s", event, like.ID)
+	}
+	select {
+	case extra := <-likes:
+		t.Errorf("filtered subscriber received %+v", extra)
+	default:
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe(nil)
+
+	bus.Close()
+	if _, ok := <-events; ok {
+		t.Error("subscription still open after Close")
+	}
+	unsubscribe()
+
+	late, _ := bus.Subscribe(nil)
+	if _, ok := <-late; ok {
+		t.Error("Subscribe() after Close returned an open channel")
+	}
+	bus.Publish(Event{Type: EventEnqueued})
+}
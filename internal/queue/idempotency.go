@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// ErrIdempotencyConflict is returned by Enqueue, together with the original
+// notification, when the idempotency key has already been used for a
+// different notification.
+var ErrIdempotencyConflict = errors.New("idempotency key already used for a different notification")
+
+// reserveKey reserves the idempotency key of notification for its owner.
+// When the owner has already used the key it returns the notification
+// originally created for it, with ErrIdempotencyConflict if request, the
+// fingerprint of the notification as received, differs from the original's.
+func (q *Queue) reserveKey(ctx context.Context, notification models.Notification, request string, now time.Time) (*models.Notification, error) {
+	existing, err := q.idempotency.Reserve(ctx, models.IdempotencyRecord{
+		Key:          scopedKey(notification),
+		Notification: notification,
+		Fingerprint:  request,
+		ExpiresAt:    now.Add(q.idempotencyTTL),
+	})
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	// Records saved before fingerprints were introduced match any request.
+	if existing.Fingerprint != "" && existing.Fingerprint != request {
+		return &existing.Notification, ErrIdempotencyConflict
+	}
+	return &existing.Notification, nil
+}
+
+// scopedKey is what the idempotency key of notification is stored under: the
+// key prefixed with its owner, and the owner's length so that no two owner
+// and key pairs give the same result.
+func scopedKey(notification models.Notification) string {
+	return fmt.Sprintf("%d:%s:%s", len(notification.Owner), notification.Owner, notification.IdempotencyKey)
+}
+
+// fingerprint identifies a notification as received from the client, to tell
+// a retried request from a different one reusing its idempotency key.
+func fingerprint(notification models.Notification) string {
+	body, _ := json.Marshal(notification)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
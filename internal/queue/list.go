@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// ErrInvalidCursor is returned when a list cursor wasn't produced by a
+// previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListFilter selects which notifications List returns. Notifications are
+// listed in enqueue order.
+type ListFilter struct {
+	Types []models.NotificationType
+	// Statuses defaults to pending and processing. Completed notifications
+	// can be listed by status until they expire.
+	Statuses  []models.NotificationStatus
+	Recipient string
+	// CreatedBefore and CreatedAfter bound the enqueue time, e.g. to find
+	// notifications that have been waiting for too long.
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	// After resumes the listing after a notification of a previous page.
+	After *Cursor
+	Limit int
+}
+
+func (f ListFilter) statuses() []models.NotificationStatus {
+	if len(f.Statuses) == 0 {
+		return []models.NotificationStatus{models.StatusPending, models.StatusProcessing}
+	}
+	return f.Statuses
+}
+
+// matches reports whether a notification passes every filter except the
+// cursor and limit.
+func (f ListFilter) matches(n models.Notification) bool {
+	if !containsValue(f.statuses(), n.Status) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsValue(f.Types, n.Type) {
+		return false
+	}
+	if f.Recipient != "" && n.Recipient != f.Recipient {
+		return false
+	}
+	if f.CreatedBefore != nil && !n.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	if f.CreatedAfter != nil && !n.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor is the position of a notification in enqueue order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func cursorOf(n models.Notification) Cursor {
+	return Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+}
+
+// before reports whether the notification at c is listed before n.
+func (c Cursor) before(n models.Notification) bool {
+	if !c.CreatedAt.Equal(n.CreatedAt) {
+		return c.CreatedAt.Before(n.CreatedAt)
+	}
+	return c.ID < n.ID
+}
+
+// Encode returns the cursor as an opaque string for clients.
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: t, ID: id}, nil
+}
+
+// Summary counts the notifications matching a filter, regardless of paging.
+type Summary struct {
+	Total    int                               `json:"total"`
+	ByStatus map[models.NotificationStatus]int `json:"byStatus"`
+	ByType   map[models.NotificationType]int   `json:"byType"`
+}
+
+func newSummary() Summary {
+	return Summary{
+		ByStatus: map[models.NotificationStatus]int{},
+		ByType:   map[models.NotificationType]int{},
+	}
+}
+
+func (s *Summary) add(status models.NotificationStatus, notificationType models.NotificationType, count int) {
+	s.Total += count
+	s.ByStatus[status] += count
+	s.ByType[notificationType] += count
+}
+
+// Page is one page of a queue listing.
+type Page struct {
+	Notifications []models.Notification `json:"notifications"`
+	// NextCursor is empty on the last page.
+	NextCursor string  `json:"nextCursor,omitempty"`
+	Summary    Summary `json:"summary"`
+}
+
+// GetQueueStatus lists a page of the notifications matching filter together
+// with a summary of all of them.
+func (q *Queue) GetQueueStatus(filter ListFilter) (*Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	limit := min(filter.Limit, MaxListLimit)
+
+	// Ask for one more than needed to know whether there is a next page.
+	filter.Limit = limit + 1
+	notifications, err := q.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Notifications: notifications}
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		page.NextCursor = cursorOf(notifications[limit-1]).Encode()
+	}
+
+	filter.After = nil
+	filter.Limit = 0
+	page.Summary, err = q.store.Summarize(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
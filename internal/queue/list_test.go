@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestGetQueueStatusPagesInEnqueueOrder(t *testing.T) {
+	q := newTestQueue()
+	ctx := context.Background()
+	start := time.Now().UTC().Add(-time.Hour)
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		q.store.Add(ctx, models.Notification{
+			ID:        id,
+			Type:      models.TypeNewLike,
+			Status:    models.StatusPending,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	var ids []string
+	filter := ListFilter{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("GetQueueStatus() never returned the last page")
+		}
+		page, err := q.GetQueueStatus(filter)
+		if err != nil {
+			t.Fatalf("GetQueueStatus() error = %v", err)
+		}
+		if page.Summary.Total != 5 {
+			t.Errorf("Summary.Total = %d, want 5 on every page", page.Summary.Total)
+		}
+		for _, n := range page.Notifications {
+			ids = append(ids, n.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		after, err := DecodeCursor(page.NextCursor)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%q) error = %v", page.NextCursor, err)
+		}
+		filter.After = &after
+	}
+
+	if got := len(ids); got != 5 || ids[0] != "a" || ids[4] != "e" {
+		t.Errorf("paged IDs = %v, want a to e", ids)
+	}
+}
+
+func TestGetQueueStatusFilters(t *testing.T) {
+	q := newTestQueue()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	q.store.Add(ctx, models.Notification{ID: "old-like", Type: models.TypeNewLike, Status: models.StatusPending, Recipient: "a@example.com", CreatedAt: now.Add(-time.Hour)})
+	q.store.Add(ctx, models.Notification{ID: "like", Type: models.TypeNewLike, Status: models.StatusProcessing, Recipient: "b@example.com", CreatedAt: now})
+	q.store.Add(ctx, models.Notification{ID: "recipe", Type: models.TypeNewRecipe, Status: models.StatusPending, CreatedAt: now})
+	q.store.Add(ctx, models.Notification{ID: "sent", Type: models.TypeNewRecipe, Status: models.StatusProcessing, LeaseOwner: "worker", CreatedAt: now})
+	q.store.Complete(ctx, "sent", "worker", models.StatusSent, &models.DeliveryReport{}, now.Add(time.Hour))
+
+	page, _ := q.GetQueueStatus(ListFilter{})
+	summary := page.Summary
+	if summary.Total != 3 || summary.ByStatus[models.StatusPending] != 2 || summary.ByType[models.TypeNewLike] != 2 {
+		t.Errorf("unfiltered summary = %+v, want the 3 active notifications", summary)
+	}
+
+	olderThan := now.Add(-30 * time.Minute)
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   string
+	}{
+		{"type", ListFilter{Types: []models.NotificationType{models.TypeNewRecipe}}, "recipe"},
+		{"status", ListFilter{Statuses: []models.NotificationStatus{models.StatusProcessing}}, "like"},
+		{"completed status", ListFilter{Statuses: []models.NotificationStatus{models.StatusSent}}, "sent"},
+		{"recipient", ListFilter{Recipient: "a@example.com"}, "old-like"},
+		{"age", ListFilter{CreatedBefore: &olderThan}, "old-like"},
+	}
+	for _, tt := range tests {
+		page, err := q.GetQueueStatus(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: GetQueueStatus() error = %v", tt.name, err)
+		}
+		if len(page.Notifications) != 1 || page.Notifications[0].ID != tt.want || page.Summary.Total != 1 {
+			t.Errorf("%s: GetQueueStatus() = %+v, want only %s", tt.name, page.Notifications, tt.want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm8tc2VwYXJhdG9y", Cursor{ID: ""}.Encode()} {
+		if _, err := DecodeCursor(cursor); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
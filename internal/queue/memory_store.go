@@ -0,0 +1,416 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// memoryMaxRetained bounds how many completed notifications MemoryStore keeps
+// for lookups, so a busy instance doesn't hold days of delivery reports.
+const memoryMaxRetained = 10000
+
+// MemoryStore keeps the queue in process memory. Everything is lost on
+// restart, so it is only meant for local development and tests. Completed
+// notifications are dropped once they expire, or oldest first once there are
+// more than maxRetained of them, on the next write.
+type MemoryStore struct {
+	notifications []models.Notification
+	maxRetained   int
+	mutex         sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		notifications: []models.Notification{},
+		maxRetained:   memoryMaxRetained,
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, notification models.Notification) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.prune(time.Now().UTC())
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *MemoryStore) AddMany(ctx context.Context, notifications []models.Notification) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.prune(time.Now().UTC())
+	s.notifications = append(s.notifications, notifications...)
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, owner string, lease time.Duration, order ClaimOrder) (*models.Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	selected := -1
+	for i, n := range s.notifications {
+		if !isClaimable(n, now) {
+			continue
+		}
+		if selected == -1 {
+			selected = i
+			if order == ClaimOldestFirst {
+				break
+			}
+			continue
+		}
+		if n.Priority > s.notifications[selected].Priority {
+			selected = i
+		}
+	}
+	if selected == -1 {
+		return nil, nil
+	}
+
+	n := s.notifications[selected]
+	expiresAt := now.Add(lease)
+	n.Status = models.StatusProcessing
+	n.Attempts++
+	n.LeaseOwner = owner
+	n.LeaseExpiresAt = &expiresAt
+	n.UpdatedAt = now
+	n.Lifecycle = append(n.Lifecycle, models.StatusChange{
+		Status: models.StatusProcessing,
+		At:     now,
+		Detail: "claimed by " + owner,
+	})
+	s.notifications[selected] = n
+	return &n, nil
+}
+
+func (s *MemoryStore) Extend(ctx context.Context, id string, owner string, lease time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for i, n := range s.notifications {
+		if n.ID == id && n.LeaseOwner == owner {
+			expiresAt := now.Add(lease)
+			s.notifications[i].LeaseExpiresAt = &expiresAt
+			s.notifications[i].UpdatedAt = now
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Retry(ctx context.Context, id string, owner string, nextAttemptAt time.Time, attempt models.Attempt, report *models.DeliveryReport) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for i, n := range s.notifications {
+		if isLeasedTo(n, id, owner) {
+			n = releaseLease(n, now, "retry scheduled for "+nextAttemptAt.Format(time.RFC3339))
+			n.NextAttemptAt = &nextAttemptAt
+			n.LastError = attempt.Error
+			n.History = append(n.History, attempt)
+			if attempt.Interrupted {
+				n.Attempts--
+			}
+			if report != nil {
+				n.Delivery = report
+			}
+			s.notifications[i] = n
+			return nil
+		}
+	}
+	return ErrLeaseLost
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, id string, owner string, status models.NotificationStatus, report *models.DeliveryReport, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	s.prune(now)
+	for i, n := range s.notifications {
+		if isLeasedTo(n, id, owner) {
+			n.Status = status
+			n.Delivery = report
+			n.CompletedAt = &now
+			n.ExpiresAt = &expiresAt
+			n.UpdatedAt = now
+			n.LeaseOwner = ""
+			n.LeaseExpiresAt = nil
+			n.NextAttemptAt = nil
+			n.Lifecycle = append(n.Lifecycle, models.StatusChange{Status: status, At: now})
+			s.notifications[i] = n
+			return nil
+		}
+	}
+	return ErrLeaseLost
+}
+
+// isLeasedTo reports whether n is the notification id, being processed under
+// a lease held by owner.
+func isLeasedTo(n models.Notification, id string, owner string) bool {
+	return n.ID == id && n.Status == models.StatusProcessing && n.LeaseOwner == owner
+}
+
+func (s *MemoryStore) Cancel(ctx context.Context, id string, expiresAt time.Time) (*models.Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for i, n := range s.notifications {
+		if n.ID == id && n.Status == models.StatusPending {
+			n.Status = models.StatusCancelled
+			n.CompletedAt = &now
+			n.ExpiresAt = &expiresAt
+			n.UpdatedAt = now
+			n.NextAttemptAt = nil
+			n.Lifecycle = append(n.Lifecycle, models.StatusChange{Status: models.StatusCancelled, At: now})
+			s.notifications[i] = n
+			return &n, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*models.Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for _, n := range s.notifications {
+		if n.ID == id && !isExpired(n, now) {
+			return &n, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, filter ListFilter) ([]models.Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	matching := []models.Notification{}
+	for _, n := range s.notifications {
+		if isExpired(n, now) || !filter.matches(n) {
+			continue
+		}
+		if filter.After != nil && !filter.After.before(n) {
+			continue
+		}
+		matching = append(matching, n)
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return cursorOf(matching[i]).before(matching[j])
+	})
+	if filter.Limit > 0 && len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+	return matching, nil
+}
+
+func (s *MemoryStore) Summarize(ctx context.Context, filter ListFilter) (Summary, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	summary := newSummary()
+	for _, n := range s.notifications {
+		if !isExpired(n, now) && filter.matches(n) {
+			summary.add(n.Status, n.Type, 1)
+		}
+	}
+	return summary, nil
+}
+
+func (s *MemoryStore) Recover(ctx context.Context) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	recovered := 0
+	for i, n := range s.notifications {
+		if n.Status == models.StatusProcessing && n.LeaseExpiresAt != nil && n.LeaseExpiresAt.Before(now) {
+			s.notifications[i] = releaseLease(n, now, "lease expired")
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+func isClaimable(n models.Notification, now time.Time) bool {
+	switch n.Status {
+	case models.StatusPending:
+		return n.NextAttemptAt == nil || !n.NextAttemptAt.After(now)
+	case models.StatusProcessing:
+		return n.LeaseExpiresAt != nil && n.LeaseExpiresAt.Before(now)
+	}
+	return false
+}
+
+func releaseLease(n models.Notification, now time.Time, detail string) models.Notification {
+	n.Status = models.StatusPending
+	n.LeaseOwner = ""
+	n.LeaseExpiresAt = nil
+	n.UpdatedAt = now
+	n.Lifecycle = append(n.Lifecycle, models.StatusChange{
+		Status: models.StatusPending,
+		At:     now,
+		Detail: detail,
+	})
+	return n
+}
+
+func isExpired(n models.Notification, now time.Time) bool {
+	return n.ExpiresAt != nil && !n.ExpiresAt.After(now)
+}
+
+// prune drops completed notifications past their expiry, and the ones
+// completed longest ago beyond maxRetained. It must be called with the mutex
+// held.
+func (s *MemoryStore) prune(now time.Time) {
+	kept := s.notifications[:0]
+	var completed []time.Time
+	for _, n := range s.notifications {
+		if isExpired(n, now) {
+			continue
+		}
+		kept = append(kept, n)
+		if n.CompletedAt != nil {
+			completed = append(completed, *n.CompletedAt)
+		}
+	}
+	s.notifications = kept
+
+	excess := len(completed) - s.maxRetained
+	if s.maxRetained <= 0 || excess <= 0 {
+		return
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].Before(completed[j]) })
+	cutoff := completed[excess-1]
+	kept = s.notifications[:0]
+	for _, n := range s.notifications {
+		if n.CompletedAt != nil && !n.CompletedAt.After(cutoff) && excess > 0 {
+			excess--
+			continue
+		}
+		kept = append(kept, n)
+	}
+	s.notifications = kept
+}
+
+type MemoryDeadLetterStore struct {
+	deadLetters []models.DeadLetter
+	mutex       sync.Mutex
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		deadLetters: []models.DeadLetter{},
+	}
+}
+
+func (s *MemoryDeadLetterStore) Add(ctx context.Context, deadLetter models.DeadLetter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, dl := range s.deadLetters {
+		if dl.ID == deadLetter.ID {
+			s.deadLetters[i] = deadLetter
+			return nil
+		}
+	}
+	s.deadLetters = append(s.deadLetters, deadLetter)
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) List(ctx context.Context) ([]models.DeadLetter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	copy := make([]models.DeadLetter, len(s.deadLetters))
+	for i, dl := range s.deadLetters {
+		copy[i] = dl
+	}
+	return copy, nil
+}
+
+func (s *MemoryDeadLetterStore) Get(ctx context.Context, id string) (*models.DeadLetter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, dl := range s.deadLetters {
+		if dl.ID == id {
+			return &dl, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryDeadLetterStore) Delete(ctx context.Context, id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, dl := range s.deadLetters {
+		if dl.ID == id {
+			s.deadLetters = append(s.deadLetters[:i], s.deadLetters[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryDeadLetterStore) Purge(ctx context.Context) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	purged := len(s.deadLetters)
+	s.deadLetters = []models.DeadLetter{}
+	return purged, nil
+}
+
+type MemoryIdempotencyStore struct {
+	records map[string]models.IdempotencyRecord
+	mutex   sync.Mutex
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: map[string]models.IdempotencyRecord{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for k, record := range s.records {
+		if !record.ExpiresAt.After(now) {
+			delete(s.records, k)
+		}
+	}
+
+	if existing, ok := s.records[record.Key]; ok {
+		return &existing, nil
+	}
+	record.CreatedAt = now
+	s.records[record.Key] = record
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,254 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestMemoryStoreClaimsInOrder(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.Add(ctx, models.Notification{ID: id, Status: models.StatusPending}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	first, err := store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if err != nil || first == nil {
+		t.Fatalf("Claim() = %v, %v", first, err)
+	}
+	if first.ID != "a" || first.Status != models.StatusProcessing || first.LeaseOwner != "worker" {
+		t.Errorf("Claim() returned %+v, want a leased to worker", first)
+	}
+
+	second, _ := store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if second == nil || second.ID != "b" {
+		t.Fatalf("second Claim() = %+v, want b", second)
+	}
+
+	if none, _ := store.Claim(ctx, "worker", time.Minute, ClaimByPriority); none != nil {
+		t.Errorf("Claim() on drained queue = %+v, want nil", none)
+	}
+
+	if err := store.Complete(ctx, "a", "worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	remaining, _ := store.List(ctx, ListFilter{})
+	if len(remaining) != 1 || remaining[0].ID != "b" {
+		t.Errorf("List() after Complete = %+v, want only b", remaining)
+	}
+}
+
+func TestMemoryStoreKeepsCompletedUntilExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "a", Status: models.StatusPending})
+	store.Add(ctx, models.Notification{ID: "b", Status: models.StatusPending})
+	store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+	store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+
+	report := &models.DeliveryReport{}
+	report.Add(models.DeliveryResult{Channel: models.ChannelEmail, Status: models.DeliverySent})
+	report.Add(models.DeliveryResult{Channel: models.ChannelPush, Status: models.DeliveryFailed})
+	store.Complete(ctx, "a", "worker", report.Status(), report, time.Now().Add(time.Hour))
+	store.Complete(ctx, "b", "worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(-time.Second))
+
+	n, err := store.Get(ctx, "a")
+	if err != nil || n == nil {
+		t.Fatalf("Get() = %v, %v", n, err)
+	}
+	if n.Status != models.StatusPartiallySent || n.CompletedAt == nil || n.LeaseOwner != "" {
+		t.Errorf("Get() after Complete = %+v, want partially_sent with lease released", n)
+	}
+	if n.Delivery == nil || n.Delivery.Email.Sent != 1 || n.Delivery.Push.Failed != 1 {
+		t.Errorf("Get() delivery = %+v, want one email sent and one push failed", n.Delivery)
+	}
+	if last := n.Lifecycle[len(n.Lifecycle)-1]; last.Status != models.StatusPartiallySent {
+		t.Errorf("last lifecycle entry = %+v, want partially_sent", last)
+	}
+
+	if n, _ := store.Get(ctx, "b"); n != nil {
+		t.Errorf("Get() on expired notification = %+v, want nil", n)
+	}
+	if none, _ := store.Claim(ctx, "worker", -time.Second, ClaimOldestFirst); none != nil {
+		t.Errorf("Claim() returned completed notification %s", none.ID)
+	}
+	if active, _ := store.List(ctx, ListFilter{}); len(active) != 0 {
+		t.Errorf("List() = %+v, want no active notifications", active)
+	}
+}
+
+func TestMemoryStoreCapsRetainedNotifications(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.maxRetained = 2
+	for _, id := range []string{"a", "b", "c", "d"} {
+		store.Add(ctx, models.Notification{ID: id, Status: models.StatusProcessing, LeaseOwner: "worker"})
+	}
+	for _, id := range []string{"b", "a", "c", "d"} {
+		store.Complete(ctx, id, "worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(time.Hour))
+	}
+	store.Add(ctx, models.Notification{ID: "e", Status: models.StatusPending})
+
+	for id, kept := range map[string]bool{"a": false, "b": false, "c": true, "d": true, "e": true} {
+		if n, _ := store.Get(ctx, id); (n != nil) != kept {
+			t.Errorf("Get(%s) = %+v, want kept %t", id, n, kept)
+		}
+	}
+}
+
+func TestMemoryStoreRecoversExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "a", Status: models.StatusPending})
+
+	if _, err := store.Claim(ctx, "crashed-worker", -time.Second, ClaimByPriority); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+
+	recovered, err := store.Recover(ctx)
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if recovered != 1 {
+		t.Errorf("Recover() = %d, want 1", recovered)
+	}
+
+	n, _ := store.Claim(ctx, "new-worker", time.Minute, ClaimByPriority)
+	if n == nil || n.ID != "a" || n.LeaseOwner != "new-worker" {
+		t.Errorf("Claim() after Recover = %+v, want a leased to new-worker", n)
+	}
+}
+
+func TestMemoryStoreReclaimsExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "a", Status: models.StatusPending})
+
+	store.Claim(ctx, "slow-worker", -time.Second, ClaimByPriority)
+
+	n, _ := store.Claim(ctx, "other-worker", time.Minute, ClaimByPriority)
+	if n == nil || n.LeaseOwner != "other-worker" {
+		t.Errorf("Claim() of expired lease = %+v, want leased to other-worker", n)
+	}
+}
+
+func TestMemoryStoreRetryHoldsBackUntilDue(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "a", Status: models.StatusPending})
+
+	n, _ := store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if n.Attempts != 1 {
+		t.Errorf("Attempts after first Claim = %d, want 1", n.Attempts)
+	}
+
+	if err := store.Retry(ctx, "a", "worker", time.Now().Add(time.Hour), models.Attempt{Number: 1, Error: "smtp timeout"}, nil); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if n, _ := store.Claim(ctx, "worker", time.Minute, ClaimByPriority); n != nil {
+		t.Errorf("Claim() before next attempt = %+v, want nil", n)
+	}
+
+	due := time.Now().Add(-time.Second)
+	store.notifications[0].NextAttemptAt = &due
+	n, _ = store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if n == nil || n.Attempts != 2 || n.LastError != "smtp timeout" || len(n.History) != 1 {
+		t.Errorf("Claim() after backoff = %+v, want second attempt with last error", n)
+	}
+}
+
+func TestMemoryStoreRejectsLostLeases(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "a", Status: models.StatusPending})
+
+	store.Claim(ctx, "slow-worker", -time.Second, ClaimByPriority)
+	store.Claim(ctx, "other-worker", time.Minute, ClaimByPriority)
+
+	if err := store.Complete(ctx, "a", "slow-worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(time.Hour)); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete() by the first owner error = %v, want ErrLeaseLost", err)
+	}
+	if err := store.Retry(ctx, "a", "slow-worker", time.Now(), models.Attempt{Number: 1}, nil); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Retry() by the first owner error = %v, want ErrLeaseLost", err)
+	}
+	n, _ := store.Get(ctx, "a")
+	if n.Status != models.StatusProcessing || n.LeaseOwner != "other-worker" || len(n.History) != 0 {
+		t.Errorf("notification after stale writes = %+v, want still processing by other-worker", n)
+	}
+
+	if err := store.Complete(ctx, "a", "other-worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("Complete() by the current owner error = %v", err)
+	}
+	if err := store.Complete(ctx, "a", "other-worker", models.StatusSent, &models.DeliveryReport{}, time.Now().Add(time.Hour)); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("second Complete() error = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestMemoryStoreConcurrentClaimsAreExclusive(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 0; i < 100; i++ {
+		store.Add(ctx, models.Notification{ID: fmt.Sprintf("n%d", i), Status: models.StatusPending})
+	}
+
+	var mutex sync.Mutex
+	claimed := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			for {
+				n, _ := store.Claim(ctx, worker, time.Minute, ClaimByPriority)
+				if n == nil {
+					return
+				}
+				mutex.Lock()
+				claimed[n.ID]++
+				mutex.Unlock()
+			}
+		}(fmt.Sprintf("worker-%d", w))
+	}
+	wg.Wait()
+
+	if len(claimed) != 100 {
+		t.Errorf("claimed %d distinct notifications, want 100", len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("notification %s claimed %d times, want 1", id, count)
+		}
+	}
+}
+
+func TestMemoryStoreClaimsByPriority(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Add(ctx, models.Notification{ID: "broadcast", Status: models.StatusPending, Priority: models.PriorityLow})
+	store.Add(ctx, models.Notification{ID: "comment", Status: models.StatusPending, Priority: models.PriorityNormal})
+	store.Add(ctx, models.Notification{ID: "password", Status: models.StatusPending, Priority: models.PriorityHigh})
+
+	n, _ := store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if n == nil || n.ID != "password" {
+		t.Fatalf("Claim(ClaimByPriority) = %+v, want password", n)
+	}
+
+	n, _ = store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+	if n == nil || n.ID != "broadcast" {
+		t.Fatalf("Claim(ClaimOldestFirst) = %+v, want broadcast", n)
+	}
+
+	n, _ = store.Claim(ctx, "worker", time.Minute, ClaimByPriority)
+	if n == nil || n.ID != "comment" {
+		t.Fatalf("Claim(ClaimByPriority) = %+v, want comment", n)
+	}
+}
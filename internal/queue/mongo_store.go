@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/database"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// MongoStore persists the queue in the notification_jobs collection so that
+// pending and in-flight notifications survive restarts.
+type MongoStore struct {
+	db *database.MongoDB
+}
+
+func NewMongoStore(ctx context.Context, db *database.MongoDB) (*MongoStore, error) {
+	if err := db.EnsureNotificationJobIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return &MongoStore{db: db}, nil
+}
+
+func (s *MongoStore) Add(ctx context.Context, notification models.Notification) error {
+	return s.db.InsertNotificationJob(ctx, notification)
+}
+
+func (s *MongoStore) AddMany(ctx context.Context, notifications []models.Notification) error {
+	return s.db.InsertNotificationJobs(ctx, notifications)
+}
+
+func (s *MongoStore) Claim(ctx context.Context, owner string, lease time.Duration, order ClaimOrder) (*models.Notification, error) {
+	return s.db.ClaimNotificationJob(ctx, owner, lease, order == ClaimByPriority)
+}
+
+func (s *MongoStore) Extend(ctx context.Context, id string, owner string, lease time.Duration) error {
+	return s.db.ExtendNotificationJobLease(ctx, id, owner, lease)
+}
+
+func (s *MongoStore) Retry(ctx context.Context, id string, owner string, nextAttemptAt time.Time, attempt models.Attempt, report *models.DeliveryReport) error {
+	leased, err := s.db.RetryNotificationJob(ctx, id, owner, nextAttemptAt, attempt, report)
+	if err == nil && !leased {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (s *MongoStore) Complete(ctx context.Context, id string, owner string, status models.NotificationStatus, report *models.DeliveryReport, expiresAt time.Time) error {
+	leased, err := s.db.CompleteNotificationJob(ctx, id, owner, status, report, expiresAt)
+	if err == nil && !leased {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (s *MongoStore) Cancel(ctx context.Context, id string, expiresAt time.Time) (*models.Notification, error) {
+	return s.db.CancelNotificationJob(ctx, id, expiresAt)
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*models.Notification, error) {
+	notification, err := s.db.GetNotificationJob(ctx, id)
+	if database.IsNotFound(err) {
+		return nil, nil
+	}
+	return notification, err
+}
+
+func (s *MongoStore) List(ctx context.Context, filter ListFilter) ([]models.Notification, error) {
+	return s.db.ListNotificationJobs(ctx, jobFilter(filter))
+}
+
+func (s *MongoStore) Summarize(ctx context.Context, filter ListFilter) (Summary, error) {
+	counts, err := s.db.CountNotificationJobs(ctx, jobFilter(filter))
+	if err != nil {
+		return Summary{}, err
+	}
+	summary := newSummary()
+	for _, c := range counts {
+		summary.add(c.Status, c.Type, c.Count)
+	}
+	return summary, nil
+}
+
+func jobFilter(filter ListFilter) database.NotificationJobFilter {
+	f := database.NotificationJobFilter{
+		Types:         filter.Types,
+		Statuses:      filter.statuses(),
+		Recipient:     filter.Recipient,
+		CreatedBefore: filter.CreatedBefore,
+		CreatedAfter:  filter.CreatedAfter,
+		Limit:         filter.Limit,
+	}
+	if filter.After != nil {
+		f.AfterCreatedAt = &filter.After.CreatedAt
+		f.AfterID = filter.After.ID
+	}
+	return f
+}
+
+func (s *MongoStore) Recover(ctx context.Context) (int, error) {
+	released, err := s.db.ReleaseExpiredNotificationJobs(ctx)
+	return int(released), err
+}
+
+// MongoDeadLetterStore keeps dead letters in the notification_dead_letters
+// collection.
+type MongoDeadLetterStore struct {
+	db *database.MongoDB
+}
+
+func NewMongoDeadLetterStore(db *database.MongoDB) *MongoDeadLetterStore {
+	return &MongoDeadLetterStore{db: db}
+}
+
+func (s *MongoDeadLetterStore) Add(ctx context.Context, deadLetter models.DeadLetter) error {
+	return s.db.InsertDeadLetter(ctx, deadLetter)
+}
+
+func (s *MongoDeadLetterStore) List(ctx context.Context) ([]models.DeadLetter, error) {
+	return s.db.ListDeadLetters(ctx)
+}
+
+func (s *MongoDeadLetterStore) Get(ctx context.Context, id string) (*models.DeadLetter, error) {
+	deadLetter, err := s.db.GetDeadLetter(ctx, id)
+	if database.IsNotFound(err) {
+		return nil, nil
+	}
+	return deadLetter, err
+}
+
+func (s *MongoDeadLetterStore) Delete(ctx context.Context, id string) (bool, error) {
+	return s.db.DeleteDeadLetter(ctx, id)
+}
+
+func (s *MongoDeadLetterStore) Purge(ctx context.Context) (int, error) {
+	purged, err := s.db.DeleteAllDeadLetters(ctx)
+	return int(purged), err
+}
+
+// MongoIdempotencyStore keeps idempotency keys in the
+// notification_idempotency_keys collection, expired by a TTL index.
+type MongoIdempotencyStore struct {
+	db *database.MongoDB
+}
+
+func NewMongoIdempotencyStore(ctx context.Context, db *database.MongoDB) (*MongoIdempotencyStore, error) {
+	if err := db.EnsureIdempotencyKeyIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return &MongoIdempotencyStore{db: db}, nil
+}
+
+func (s *MongoIdempotencyStore) Reserve(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	record.CreatedAt = time.Now().UTC()
+	return s.db.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *MongoIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.db.DeleteIdempotencyKey(ctx, key)
+}
@@ -2,9 +2,12 @@ package queue
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,16 +17,42 @@ import (
 	"github.com/jorbush/jorbites-notifier/internal/i18n"
 	"github.com/jorbush/jorbites-notifier/internal/models"
 	"github.com/jorbush/jorbites-notifier/internal/push"
+	"github.com/jorbush/jorbites-notifier/internal/webhook"
 )
 
 type Queue struct {
-	notifications []models.Notification
-	mutex         sync.Mutex
-	processing    bool
-	notifyChan    chan struct{}
-	emailSender   *email.EmailSender
-	pushSender    *push.PushSender
-	mongoDB       *database.MongoDB
+	store          Store
+	deadLetters    DeadLetterStore
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
+	retention      time.Duration
+	dryRun         bool
+	mutex          sync.Mutex
+	processing     bool
+	notifyChan     chan struct{}
+	stopping       chan struct{}
+	draining       atomic.Bool
+	workers        sync.WaitGroup
+	inFlight       map[string]inFlightJob
+	interruptGrace time.Duration
+	events         *EventBus
+	depth          depthCache
+	instanceID     string
+	workerCount    int
+	claims         atomic.Uint64
+	fairShare      uint64
+	leaseDuration  time.Duration
+	retryPolicy    RetryPolicy
+	emailSender    mailer
+	pushSender     pusher
+	users          directory
+	mongoDB        *database.MongoDB
+
+	webhookURL       string
+	callbackHosts    webhook.AllowList
+	callbacks        callbackSender
+	callbackRetry    RetryPolicy
+	pendingCallbacks sync.WaitGroup
 }
 
 func NewQueue(cfg *config.Config) *Queue {
@@ -32,43 +61,316 @@ func NewQueue(cfg *config.Config) *Queue {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 
+	store, deadLetters, idempotency, err := newStores(cfg, mongoDB)
+	if err != nil {
+		log.Fatalf("Failed to initialize queue store: %v", err)
+	}
+
+	workerCount := cfg.WorkerCount
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	leaseDuration := cfg.QueueLeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = 2 * time.Minute
+	}
+
+	var callbacks callbackSender
+	if cfg.WebhookSecret != "" {
+		callbacks = webhook.NewSender(cfg)
+	} else if cfg.WebhookURL != "" {
+		log.Println("WEBHOOK_URL is set but WEBHOOK_SECRET is not; delivery callbacks are disabled")
+	}
+
 	return &Queue{
-		notifications: []models.Notification{},
-		notifyChan:    make(chan struct{}, 1),
-		processing:    false,
-		emailSender:   email.NewEmailSender(cfg),
-		pushSender:    push.NewPushSender(cfg, mongoDB),
-		mongoDB:       mongoDB,
+		store:          store,
+		deadLetters:    deadLetters,
+		idempotency:    idempotency,
+		idempotencyTTL: cfg.IdempotencyWindow,
+		retention:      cfg.NotificationRetention,
+		dryRun:         cfg.DryRun,
+		notifyChan:     make(chan struct{}, workerCount),
+		stopping:       make(chan struct{}),
+		inFlight:       make(map[string]inFlightJob),
+		interruptGrace: defaultInterruptGrace,
+		events:         NewEventBus(),
+		processing:     false,
+		instanceID:     uuid.New().String(),
+		workerCount:    workerCount,
+		fairShare:      uint64(max(cfg.QueueFairShare, 0)),
+		leaseDuration:  leaseDuration,
+		retryPolicy:    NewRetryPolicy(cfg),
+		emailSender:    email.NewEmailSender(cfg),
+		pushSender:     push.NewPushSender(cfg, mongoDB),
+		users:          mongoDB,
+		mongoDB:        mongoDB,
+		webhookURL:     cfg.WebhookURL,
+		callbackHosts:  webhook.NewAllowList(cfg),
+		callbacks:      callbacks,
+		callbackRetry: RetryPolicy{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			BaseDelay:   cfg.WebhookRetryBaseDelay,
+			MaxDelay:    cfg.WebhookRetryMaxDelay,
+			Jitter:      cfg.QueueRetryJitter,
+		},
 	}
 }
 
-func (q *Queue) Enqueue(notification models.Notification) {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
+func newStores(cfg *config.Config, mongoDB *database.MongoDB) (Store, DeadLetterStore, IdempotencyStore, error) {
+	switch cfg.QueueBackend {
+	case config.QueueBackendMemory:
+		log.Println("Using in-memory queue store (notifications will not survive restarts)")
+		return NewMemoryStore(), NewMemoryDeadLetterStore(), NewMemoryIdempotencyStore(), nil
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		log.Println("Using MongoDB queue store")
+		store, err := NewMongoStore(ctx, mongoDB)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		idempotency, err := NewMongoIdempotencyStore(ctx, mongoDB)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return store, NewMongoDeadLetterStore(mongoDB), idempotency, nil
+	}
+}
+
+// ErrShuttingDown is returned by Enqueue once Shutdown has been called.
+var ErrShuttingDown = errors.New("notification queue is shutting down")
+
+// errInterrupted is returned by sends that shutdown stopped.
+var errInterrupted = errors.New("interrupted by shutdown")
+
+// ErrDuplicate is returned by Enqueue, together with the original
+// notification, when the idempotency key has already been used.
+var ErrDuplicate = errors.New("duplicate idempotency key")
+
+func (q *Queue) Enqueue(notification models.Notification) (models.Notification, error) {
+	return q.enqueue(notification, nil)
+}
 
+// enqueue is Enqueue for a notification that resumes from an earlier
+// delivery report, so the recipients it records as delivered to are skipped.
+func (q *Queue) enqueue(notification models.Notification, delivery *models.DeliveryReport) (models.Notification, error) {
+	if q.draining.Load() {
+		return notification, ErrShuttingDown
+	}
+
+	now := time.Now().UTC()
+	request := fingerprint(notification)
+	notification = q.prepare(notification, now)
+	notification.Delivery = delivery
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if notification.IdempotencyKey != "" && !notification.DryRun {
+		original, err := q.reserveKey(ctx, notification, request, now)
+		if errors.Is(err, ErrIdempotencyConflict) {
+			log.Printf("Idempotency key %q of %s already used by notification %s for a different request", notification.IdempotencyKey, notification.Owner, original.ID)
+			return *original, err
+		}
+		if err != nil {
+			return notification, err
+		}
+		if original != nil {
+			log.Printf("Idempotency key %q of %s already used by notification %s, not enqueuing again", notification.IdempotencyKey, notification.Owner, original.ID)
+			return *original, ErrDuplicate
+		}
+	}
+
+	if err := q.store.Add(ctx, notification); err != nil {
+		q.releaseKeys(ctx, []models.Notification{notification})
+		return notification, err
+	}
+
+	q.wake()
+	q.countEnqueued([]models.Notification{notification})
+	logEnqueued(notification)
+	q.publish(EventEnqueued, notification)
+	return notification, nil
+}
+
+// EnqueueResult is the outcome of enqueuing one notification of a batch.
+type EnqueueResult struct {
+	Notification models.Notification
+	// Duplicate is set when the idempotency key was already used, in which
+	// case Notification is the one originally created for it.
+	Duplicate bool
+	// Conflict is set along with Duplicate when the key was used for a
+	// different notification.
+	Conflict bool
+}
+
+// EnqueueBatch enqueues several notifications at once. Notifications whose
+// idempotency key has already been used are reported as duplicates, or
+// conflicts; the rest are added to the store in a single operation, so either
+// all of them are queued or, on error, none are.
+func (q *Queue) EnqueueBatch(notifications []models.Notification) ([]EnqueueResult, error) {
+	if q.draining.Load() {
+		return nil, ErrShuttingDown
+	}
+
+	now := time.Now().UTC()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results := make([]EnqueueResult, len(notifications))
+	var accepted []models.Notification
+	for i, notification := range notifications {
+		request := fingerprint(notification)
+		notification = q.prepare(notification, now)
+
+		if notification.IdempotencyKey != "" && !notification.DryRun {
+			original, err := q.reserveKey(ctx, notification, request, now)
+			if err != nil && !errors.Is(err, ErrIdempotencyConflict) {
+				q.releaseKeys(ctx, accepted)
+				return nil, err
+			}
+			if original != nil {
+				results[i] = EnqueueResult{Notification: *original, Duplicate: true, Conflict: err != nil}
+				continue
+			}
+		}
+
+		results[i] = EnqueueResult{Notification: notification}
+		accepted = append(accepted, notification)
+	}
+
+	if len(accepted) > 0 {
+		if err := q.store.AddMany(ctx, accepted); err != nil {
+			q.releaseKeys(ctx, accepted)
+			return nil, err
+		}
+		q.wake()
+		q.countEnqueued(accepted)
+		for _, notification := range accepted {
+			q.publish(EventEnqueued, notification)
+		}
+	}
+
+	log.Printf("Batch of %d notifications enqueued (%d duplicates)", len(accepted), len(notifications)-len(accepted))
+	return results, nil
+}
+
+// prepare turns a notification received from a client into a pending job:
+// it assigns an ID, resets the processing state and resolves the schedule.
+// With DRY_RUN set every notification is a dry run.
+func (q *Queue) prepare(notification models.Notification, now time.Time) models.Notification {
 	notification.ID = uuid.New().String()
+	notification.DryRun = notification.DryRun || q.dryRun
 	notification.Status = models.StatusPending
+	if notification.Priority == 0 {
+		notification.Priority = models.DefaultPriority(notification.Type)
+	}
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+	notification.LeaseOwner = ""
+	notification.LeaseExpiresAt = nil
+	notification.Attempts = 0
+	notification.NextAttemptAt = nil
+	notification.LastError = ""
+	notification.History = nil
+	notification.Delivery = nil
+	notification.CompletedAt = nil
+	notification.ExpiresAt = nil
+
+	if notification.DelaySeconds > 0 && notification.SendAt == nil {
+		sendAt := now.Add(time.Duration(notification.DelaySeconds) * time.Second)
+		notification.SendAt = &sendAt
+	}
+	notification.DelaySeconds = 0
+	if notification.SendAt != nil {
+		sendAt := notification.SendAt.UTC()
+		notification.SendAt = &sendAt
+		if sendAt.After(now) {
+			notification.NextAttemptAt = &sendAt
+		}
+	}
 
-	q.notifications = append(q.notifications, notification)
+	enqueued := models.StatusChange{Status: models.StatusPending, At: now, Detail: "enqueued"}
+	if notification.NextAttemptAt != nil {
+		enqueued.Detail = "scheduled for " + notification.NextAttemptAt.Format(time.RFC3339)
+	}
+	notification.Lifecycle = []models.StatusChange{enqueued}
 
-	select {
-	case q.notifyChan <- struct{}{}:
-	default:
+	return notification
+}
+
+// releaseKeys forgets the idempotency keys reserved for notifications that
+// could not be added to the store.
+func (q *Queue) releaseKeys(ctx context.Context, notifications []models.Notification) {
+	for _, notification := range notifications {
+		if notification.IdempotencyKey == "" || notification.DryRun {
+			continue
+		}
+		if err := q.idempotency.Release(ctx, scopedKey(notification)); err != nil {
+			log.Printf("Error releasing idempotency key %q: %v", notification.IdempotencyKey, err)
+		}
 	}
+}
 
-	log.Printf("Notification %s added to queue. Queue size: %d", notification.ID, len(q.notifications))
+func logEnqueued(notification models.Notification) {
+	if notification.NextAttemptAt != nil {
+		log.Printf("Notification %s scheduled for %s with %s priority", notification.ID, notification.NextAttemptAt.Format(time.RFC3339), notification.Priority)
+	} else {
+		log.Printf("Notification %s added to queue with %s priority", notification.ID, notification.Priority)
+	}
 }
 
-func (q *Queue) GetQueueStatus() (int, []models.Notification) {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
+// GetNotification returns a notification in any status, including completed
+// ones until their retention period runs out.
+func (q *Queue) GetNotification(id string) (*models.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	notification, err := q.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if notification == nil {
+		return nil, ErrNotFound
+	}
+	return notification, nil
+}
 
-	copy := make([]models.Notification, len(q.notifications))
-	for i, n := range q.notifications {
-		copy[i] = n
+// ErrNotPending is returned by CancelNotification, together with the
+// notification, when it is already being processed or has completed.
+var ErrNotPending = errors.New("notification is no longer pending")
+
+// CancelNotification stops a pending notification from being processed.
+func (q *Queue) CancelNotification(id string) (*models.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cancelled, err := q.store.Cancel(ctx, id, time.Now().UTC().Add(q.retention))
+	if err != nil {
+		return nil, err
+	}
+	if cancelled != nil {
+		log.Printf("Notification %s cancelled", id)
+		q.publish(EventCancelled, *cancelled)
+		return cancelled, nil
 	}
 
-	return len(q.notifications), copy
+	notification, err := q.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if notification == nil {
+		return nil, ErrNotFound
+	}
+	return notification, ErrNotPending
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.notifyChan <- struct{}{}:
+	default:
+	}
 }
 
 func (q *Queue) StartProcessing() {
@@ -80,682 +382,715 @@ func (q *Queue) StartProcessing() {
 	q.processing = true
 	q.mutex.Unlock()
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	recovered, err := q.store.Recover(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("Error recovering queued notifications: %v", err)
+	} else if recovered > 0 {
+		log.Printf("Recovered %d notifications with expired leases", recovered)
+	}
+
+	for i := 0; i < q.workerCount; i++ {
+		q.workers.Add(1)
+		go q.runWorker(fmt.Sprintf("%s-%d", q.instanceID, i))
+	}
+
+	log.Printf("Notification queue processing started with %d workers", q.workerCount)
+	if q.dryRun {
+		log.Println("DRY_RUN is enabled: notifications are processed but nothing is sent")
+	}
+}
+
+// defaultInterruptGrace is how long Shutdown waits, once its deadline has
+// passed, for interrupted workers to finish the send they are in the middle
+// of and checkpoint their notifications.
+const defaultInterruptGrace = 2 * time.Second
+
+// Shutdown stops accepting notifications and waits for the workers to finish
+// the notifications they are processing, including their push sends. If ctx
+// expires first, the workers are interrupted: they stop sending and
+// checkpoint their notifications back to pending with the deliveries made so
+// far, so the next instance picks them up straight away and only sends to the
+// recipients that are left. Finally the MongoDB connection is closed.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	if q.draining.Swap(true) {
+		return nil
+	}
+	close(q.stopping)
+
+	workersDone := make(chan struct{})
 	go func() {
-		for {
-			select {
-			case <-q.notifyChan:
-			case <-time.After(5 * time.Second):
-			}
+		q.workers.Wait()
+		close(workersDone)
+	}()
+	done := make(chan struct{})
+	go func() {
+		<-workersDone
+		// Callbacks waiting for a retry give up once stopping is closed;
+		// wait for the ones being sent right now.
+		q.pendingCallbacks.Wait()
+		close(done)
+	}()
 
-			q.processNextNotification()
+	var err error
+	select {
+	case <-done:
+		log.Println("Notification queue drained")
+	case <-ctx.Done():
+		err = ctx.Err()
+		q.interrupt()
+		select {
+		case <-workersDone:
+		case <-time.After(q.interruptGrace):
+			log.Println("Workers still busy after being interrupted")
 		}
-	}()
+		// Workers stuck in a send haven't checkpointed their notifications;
+		// do it for them with what they have recorded.
+		q.checkpoint()
+	}
 
-	log.Println("Notification queue processing started")
+	if q.mongoDB != nil {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if closeErr := q.mongoDB.Close(closeCtx); closeErr != nil {
+			log.Printf("Error closing MongoDB connection: %v", closeErr)
+		}
+	}
+	return err
+}
+
+// inFlightJob is a notification being processed, tracked so Shutdown can
+// interrupt and checkpoint it.
+type inFlightJob struct {
+	owner    string
+	attempt  models.Attempt
+	delivery *delivery
+	cancel   context.CancelFunc
+}
+
+// interrupt stops every notification being processed from sending anything
+// more.
+func (q *Queue) interrupt() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, job := range q.inFlight {
+		job.cancel()
+	}
 }
 
-func (q *Queue) processNextNotification() {
+// checkpoint puts every notification still being processed back to pending.
+func (q *Queue) checkpoint() {
 	q.mutex.Lock()
+	ids := make([]string, 0, len(q.inFlight))
+	for id := range q.inFlight {
+		ids = append(ids, id)
+	}
+	q.mutex.Unlock()
 
-	if len(q.notifications) == 0 {
-		q.mutex.Unlock()
+	for _, id := range ids {
+		if job, ok := q.untrack(id); ok {
+			q.checkpointJob(id, job)
+		}
+	}
+}
+
+// checkpointJob returns an interrupted notification to pending, due straight
+// away, recording the deliveries made so far so they are not sent again. The
+// interrupted attempt is kept in the history but given back, so redeploys
+// can't use up a notification's retries.
+func (q *Queue) checkpointJob(id string, job inFlightJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	attempt := job.attempt
+	attempt.FinishedAt = now
+	attempt.Error = errInterrupted.Error()
+	attempt.Interrupted = true
+	report := job.delivery.Report()
+	if err := q.store.Retry(ctx, id, job.owner, now, attempt, &report); err != nil {
+		log.Printf("Error checkpointing notification %s: %v", id, err)
 		return
 	}
+	log.Printf("Notification %s interrupted by shutdown and returned to the queue (email: %d sent; push: %d sent)", id, report.Email.Sent, report.Push.Sent)
+}
 
-	notification := q.notifications[0]
-	notification.Status = models.StatusProcessing
-	q.notifications[0] = notification
-	q.mutex.Unlock()
+// runWorker repeatedly claims and processes notifications until Shutdown is
+// called. Workers sleep until a notification is enqueued, or poll every few
+// seconds for retries that have become due.
+func (q *Queue) runWorker(workerID string) {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.stopping:
+			return
+		case <-q.notifyChan:
+		case <-time.After(5 * time.Second):
+		}
 
-	log.Printf("Processing notification %s of type %s", notification.ID, notification.Type)
+		for !q.draining.Load() && q.processNextNotification(workerID) {
+		}
+	}
+}
 
-	success := q.processNotificationByType(notification)
+// processNextNotification claims and processes a single notification. It
+// reports whether a notification was found so the caller can keep draining.
+func (q *Queue) processNextNotification(workerID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	notification, err := q.store.Claim(ctx, workerID, q.leaseDuration, q.nextClaimOrder())
+	cancel()
+	if err != nil {
+		log.Printf("Error claiming notification: %v", err)
+		return false
+	}
+	if notification == nil {
+		return false
+	}
+
+	// There may be more work behind this notification; let an idle worker
+	// pick it up instead of waiting for this one to finish.
+	q.wake()
+
+	if notification.Attempts > q.retryPolicy.MaxAttempts {
+		// A previous attempt ran out of retries but could not be moved to the
+		// dead-letter store; don't deliver it yet again.
+		q.deadLetter(*notification, models.DeadLetterRetriesExhausted, models.Attempt{
+			Number:     notification.Attempts,
+			StartedAt:  time.Now().UTC(),
+			FinishedAt: time.Now().UTC(),
+			Error:      notification.LastError,
+		}, nil)
+		return true
+	}
+
+	log.Printf("Worker %s processing notification %s of type %s (attempt %d)", workerID, notification.ID, notification.Type, notification.Attempts)
+
+	startedAt := time.Now().UTC()
+	// Recipients an earlier attempt delivered to are carried over and not
+	// sent to again.
+	deliveryCtx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	d := newDelivery(deliveryCtx, notification.DryRun || q.dryRun, notification.Delivery)
+	q.track(notification.ID, inFlightJob{
+		owner:    workerID,
+		attempt:  models.Attempt{Number: notification.Attempts, StartedAt: startedAt},
+		delivery: d,
+		cancel:   interrupt,
+	})
+	defer q.untrack(notification.ID)
+
+	q.publish(EventProcessing, *notification)
+
+	stopRenewing := q.renewLease(notification.ID, workerID)
+	d.onRecord = func(result models.DeliveryResult) {
+		q.events.Publish(Event{
+			Type:             EventDelivery,
+			NotificationID:   notification.ID,
+			NotificationType: notification.Type,
+			Attempt:          notification.Attempts,
+			Delivery:         &result,
+		})
+	}
+	err = q.processNotificationByType(*notification, d)
+	d.wait()
+	stopRenewing()
+	report := d.Report()
+
+	if d.interrupted() {
+		// Unless Shutdown gave up waiting and checkpointed it already.
+		if job, ok := q.untrack(notification.ID); ok {
+			q.checkpointJob(notification.ID, job)
+		}
+		return true
+	}
+
+	log.Printf("Notification %s processed with success: %t", notification.ID, err == nil)
+
+	if err != nil {
+		attempt := models.Attempt{
+			Number:     notification.Attempts,
+			StartedAt:  startedAt,
+			FinishedAt: time.Now().UTC(),
+			Error:      err.Error(),
+		}
+
+		if !q.retryPolicy.ShouldRetry(notification.Attempts, err) {
+			reason := models.DeadLetterRetriesExhausted
+			if IsPermanent(err) {
+				reason = models.DeadLetterPermanentFailure
+			}
+			log.Printf("Notification %s failed permanently after %d attempts: %v", notification.ID, notification.Attempts, err)
+			q.deadLetter(*notification, reason, attempt, &report)
+			return true
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		nextAttemptAt := time.Now().UTC().Add(q.retryPolicy.Delay(notification.Attempts))
+		if retryErr := q.store.Retry(ctx, notification.ID, workerID, nextAttemptAt, attempt, &report); retryErr != nil {
+			log.Printf("Error scheduling retry for notification %s: %v", notification.ID, retryErr)
+		} else {
+			log.Printf("Notification %s failed: %v. Retrying at %s", notification.ID, err, nextAttemptAt.Format(time.RFC3339))
+			q.events.Publish(Event{
+				Type:             EventRetry,
+				NotificationID:   notification.ID,
+				NotificationType: notification.Type,
+				Status:           models.StatusPending,
+				Attempt:          notification.Attempts,
+				Error:            err.Error(),
+			})
+		}
+		return true
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	status := report.Status()
+	if d.dryRun && status == models.StatusSent {
+		status = models.StatusDryRun
+	}
+	if err := q.store.Complete(ctx, notification.ID, workerID, status, &report, time.Now().UTC().Add(q.retention)); err != nil {
+		log.Printf("Error completing notification %s: %v", notification.ID, err)
+	} else {
+		log.Printf("Notification %s %s (email: %d sent, %d failed; push: %d sent, %d failed)", notification.ID, status,
+			report.Email.Sent, report.Email.Failed, report.Push.Sent, report.Push.Failed)
+		q.events.Publish(Event{
+			Type:             EventCompleted,
+			NotificationID:   notification.ID,
+			NotificationType: notification.Type,
+			Status:           status,
+			Attempt:          notification.Attempts,
+		})
+		q.sendCallback(*notification, status, &report, "")
+	}
+	return true
+}
+
+// Events is the stream of queue events, for live monitoring.
+func (q *Queue) Events() *EventBus {
+	return q.events
+}
+
+// Database is the MongoDB connection the queue uses for users and
+// subscriptions.
+func (q *Queue) Database() *database.MongoDB {
+	return q.mongoDB
+}
 
-	log.Printf("Notification %s processed with success: %t", notification.ID, success)
+func (q *Queue) publish(eventType EventType, notification models.Notification) {
+	q.events.Publish(Event{
+		Type:             eventType,
+		NotificationID:   notification.ID,
+		NotificationType: notification.Type,
+		Status:           notification.Status,
+		Attempt:          notification.Attempts,
+	})
+}
+
+// track records a notification as in flight so Shutdown can checkpoint it.
+func (q *Queue) track(id string, job inFlightJob) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.inFlight[id] = job
+}
 
+// untrack forgets an in-flight notification, reporting whether it was still
+// tracked.
+func (q *Queue) untrack(id string) (inFlightJob, bool) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
+	job, ok := q.inFlight[id]
+	delete(q.inFlight, id)
+	return job, ok
+}
 
-	if len(q.notifications) > 0 && q.notifications[0].ID == notification.ID {
-		q.notifications = q.notifications[1:]
-		log.Printf("Notification %s processed. Queue size: %d", notification.ID, len(q.notifications))
+// nextClaimOrder serves notifications by priority, except that every
+// fairShare-th claim takes the oldest notification regardless of priority so
+// that a steady stream of transactional mail cannot starve broadcasts.
+func (q *Queue) nextClaimOrder() ClaimOrder {
+	if q.fairShare > 0 && q.claims.Add(1)%q.fairShare == 0 {
+		return ClaimOldestFirst
 	}
+	return ClaimByPriority
+}
+
+// renewLease keeps extending the lease on a notification while it is being
+// processed, so long broadcasts are not reclaimed by another worker.
+func (q *Queue) renewLease(id string, workerID string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := q.store.Extend(ctx, id, workerID, q.leaseDuration); err != nil {
+					log.Printf("Error extending lease for notification %s: %v", id, err)
+				}
+				cancel()
+			}
+		}
+	}()
+	return func() { close(done) }
 }
 
-func (q *Queue) processNotificationByType(notification models.Notification) bool {
+func (q *Queue) processNotificationByType(notification models.Notification, d *delivery) error {
+	notification = normalizeMetadata(notification)
+
 	switch notification.Type {
-	case models.TypeNewRecipe:
-		return q.processNewRecipeNotification(notification)
-	case models.TypeNewBlog:
-		return q.processNewBlogNotification(notification)
-	case models.TypeNewEvent:
-		return q.processNewEventNotification(notification)
-	case models.TypeEventEndingSoon:
-		return q.processEventEndingSoonNotification(notification)
+	case models.TypeNewRecipe, models.TypeNewBlog, models.TypeNewEvent, models.TypeEventEndingSoon, models.TypeNewQuest, models.TypeNewChallenge:
+		return q.broadcast(notification, pushURL(notification), d)
 	case models.TypeForgotPassword:
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		user, err := q.mongoDB.GetUserByEmail(ctx, notification.Recipient)
+		user, err := q.users.GetUserByEmail(ctx, notification.Recipient)
 		var language string = "es"
+		var userID string
 		if err != nil {
 			log.Printf("Error fetching user for recipient %s: %v (using default language)", notification.Recipient, err)
 		} else {
 			language = i18n.GetUserLanguage(user)
+			userID = user.ID.Hex()
 		}
 
-		success, err := q.emailSender.SendNotificationEmail(notification, language)
-		if err != nil {
-			log.Printf("Error sending email for notification %s: %v", notification.ID, err)
-			return false
-		}
-		return success
+		return q.sendEmail(notification, userID, language, d)
 
 	case models.TypeNewComment, models.TypeNewLike, models.TypeNotificationsActivated, models.TypeQuestFulfilled:
 		// 1. Lookup User first (needed for both Push and Email preference)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		user, err := q.mongoDB.GetUserByEmail(ctx, notification.Recipient)
+		user, err := q.users.GetUserByEmail(ctx, notification.Recipient)
 		if err != nil {
 			log.Printf("Error fetching user for recipient %s: %v", notification.Recipient, err)
-			return false
+			return recipientLookupError(err)
 		}
 
 		language := i18n.GetUserLanguage(user)
 
-		var success bool = true
-		if user.EmailNotifications {
-			var err error
-			success, err = q.emailSender.SendNotificationEmail(notification, language)
-			if err != nil {
-				log.Printf("Error sending email for notification %s: %v", notification.ID, err)
-				success = false
-			}
-		} else {
-			log.Printf("Skipping email for %s (notifications disabled)", notification.Recipient)
-		}
-
-		userID := user.ID.Hex()
-
-		var title, message, url string
-		switch notification.Type {
-		case models.TypeNewLike:
-			recipeId := notification.Metadata["recipeId"]
-			pushTexts := i18n.GetPushNotificationText(models.TypeNewLike, language, notification.Metadata)
-			title = pushTexts.Title
-			message = pushTexts.Message
-			url = "/recipes/" + recipeId
-		case models.TypeNewComment:
-			recipeId := notification.Metadata["recipeId"]
-			pushTexts := i18n.GetPushNotificationText(models.TypeNewComment, language, notification.Metadata)
-			title = pushTexts.Title
-			message = pushTexts.Message
-			url = "/recipes/" + recipeId
-		case models.TypeNotificationsActivated:
-			pushTexts := i18n.GetPushNotificationText(models.TypeNotificationsActivated, language, notification.Metadata)
-			title = pushTexts.Title
-			message = pushTexts.Message
-			url = "/"
-		case models.TypeQuestFulfilled:
-			pushTexts := i18n.GetPushNotificationText(models.TypeQuestFulfilled, language, notification.Metadata)
-			title = pushTexts.Title
-			message = pushTexts.Message
-			url = "/quests/" + notification.Metadata["questId"]
-		}
-
-		if title != "" {
-			log.Printf("Sending push notification '%s' to user %s", title, userID)
-
-			subsCtx, subsCancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer subsCancel()
-
-			subs, err := q.mongoDB.GetPushSubscriptionsForUsers(subsCtx, []string{userID})
-			if err != nil {
-				log.Printf("Error fetching push subscriptions for user %s: %v", userID, err)
-			} else {
-				log.Printf("Found %d push subscriptions for user %s", len(subs), userID)
-				for _, sub := range subs {
-					go func(s models.PushSubscription) {
-						if err := q.pushSender.SendNotification(s, title, message, url); err != nil {
-							log.Printf("Error sending push to %s: %v", s.ID.Hex(), err)
-						} else {
-							log.Printf("Push sent to subscription %s", s.ID.Hex())
-						}
-					}(sub)
-				}
-			}
-		} else {
-			log.Printf("No push notification title set for type %s", notification.Type)
-		}
-
-		return success
+		return q.sendToUser(notification, user, language, pushURL(notification), d)
 	case models.TypeMentionInComment:
-		return q.processMentionInCommentNotification(notification)
-	case models.TypeNewQuest:
-		return q.processNewQuestNotification(notification)
-	case models.TypeNewChallenge:
-		return q.processNewChallengeNotification(notification)
+		return q.processMentionInCommentNotification(notification, d)
 	case models.TypeNewBadge:
-		return q.processNewBadgeNotification(notification)
+		return q.processNewBadgeNotification(notification, d)
 	case models.TypeVerified:
-		return q.processVerifiedNotification(notification)
+		return q.processVerifiedNotification(notification, d)
 	default:
 		log.Printf("Unknown notification type: %s", notification.Type)
-		return false
+		return Permanent(fmt.Errorf("unknown notification type: %s", notification.Type))
 	}
 }
 
-func (q *Queue) broadcastPushNotificationMultiLang(notification models.Notification, url string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// sendEmail sends the notification email to its recipient and records the
+// outcome, unless an earlier attempt already sent it.
+func (q *Queue) sendEmail(notification models.Notification, userID string, language string, d *delivery) error {
+	if d.emailed(notification.Recipient) {
+		log.Printf("Email for notification %s already sent to %s by an earlier attempt", notification.ID, notification.Recipient)
+		return nil
+	}
+	if d.interrupted() {
+		return errInterrupted
+	}
 
-	subs, err := q.mongoDB.GetAllPushSubscriptions(ctx)
+	subject, err := q.deliverEmail(notification, language, d)
 	if err != nil {
-		log.Printf("Error fetching push subscriptions for broadcast: %v", err)
-		return
+		log.Printf("Error sending email for notification %s: %v", notification.ID, err)
 	}
+	d.recordError(models.DeliveryResult{
+		Channel:   models.ChannelEmail,
+		Recipient: notification.Recipient,
+		UserID:    userID,
+		Language:  language,
+		Title:     subject,
+	}, err)
+	return err
+}
 
-	for _, sub := range subs {
-		go func(s models.PushSubscription) {
-			userCtx, userCancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer userCancel()
+// deliverEmail sends the email, or in a dry run only renders it and returns
+// its subject.
+func (q *Queue) deliverEmail(notification models.Notification, language string, d *delivery) (string, error) {
+	if !d.dryRun {
+		_, err := q.emailSender.SendNotificationEmail(notification, language)
+		return "", err
+	}
 
-			user, err := q.mongoDB.GetUserByID(userCtx, s.UserID.Hex())
-			var language string = "es"
-			if err != nil {
-				log.Printf("Error fetching user %s for push notification: %v (using default language)", s.UserID.Hex(), err)
-			} else {
-				language = i18n.GetUserLanguage(user)
-			}
+	if notification.Recipient == "" {
+		return "", fmt.Errorf("no recipient specified")
+	}
+	subject, _, err := email.GetEmailTemplate(notification.Type, notification.Metadata, language)
+	if err != nil {
+		return "", fmt.Errorf("error preparing email template: %w", err)
+	}
+	log.Printf("Dry run: would email %s (%s) with subject %q", notification.Recipient, language, subject)
+	return subject, nil
+}
 
-			pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
+// sendToUser delivers a single-recipient notification: an email when the user
+// has email notifications enabled, and a push to each of their subscriptions.
+func (q *Queue) sendToUser(notification models.Notification, user *models.User, language string, url string, d *delivery) error {
+	userID := user.ID.Hex()
 
-			if err := q.pushSender.SendNotification(s, pushTexts.Title, pushTexts.Message, url); err != nil {
-				log.Printf("Error sending push to %s: %v", s.ID.Hex(), err)
-			}
-		}(sub)
+	var emailErr error
+	if user.EmailNotifications {
+		emailErr = q.sendEmail(notification, userID, language, d)
+	} else {
+		log.Printf("Skipping email for %s (notifications disabled)", notification.Recipient)
+		d.record(models.DeliveryResult{
+			Channel:   models.ChannelEmail,
+			Status:    models.DeliverySkipped,
+			Recipient: notification.Recipient,
+			UserID:    userID,
+			Error:     "email notifications disabled",
+		})
 	}
-}
 
-func (q *Queue) sendPushToUsersMultiLang(userIDs []string, notification models.Notification, url string) {
-	if len(userIDs) == 0 {
-		return
+	pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
+	if pushTexts.Title == "" {
+		log.Printf("No push notification title set for type %s", notification.Type)
+		return emailErr
 	}
+
+	log.Printf("Sending push notification '%s' to user %s", pushTexts.Title, userID)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	subs, err := q.mongoDB.GetPushSubscriptionsForUsers(ctx, userIDs)
+	subs, err := q.users.GetPushSubscriptionsForUsers(ctx, []string{userID})
 	if err != nil {
-		log.Printf("Error fetching push subscriptions for users: %v", err)
-		return
+		log.Printf("Error fetching push subscriptions for user %s: %v", userID, err)
+		d.recordError(models.DeliveryResult{Channel: models.ChannelPush, UserID: userID}, err)
+		return emailErr
 	}
 
-	log.Printf("Found %d push subscriptions for users %v", len(subs), userIDs)
-
-	for _, sub := range subs {
-		go func(s models.PushSubscription) {
-			userCtx, userCancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer userCancel()
-
-			user, err := q.mongoDB.GetUserByID(userCtx, s.UserID.Hex())
-			var language string = "es"
-			if err != nil {
-				log.Printf("Error fetching user %s for push notification: %v (using default language)", s.UserID.Hex(), err)
-			} else {
-				language = i18n.GetUserLanguage(user)
-			}
+	log.Printf("Found %d push subscriptions for user %s", len(subs), userID)
+	for _, sub := range d.unpushed(subs) {
+		d.send(func() {
+			q.sendPush(sub, pushTexts, language, url, d)
+		})
+	}
 
-			pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
+	return emailErr
+}
 
-			if err := q.pushSender.SendNotification(s, pushTexts.Title, pushTexts.Message, url); err != nil {
-				log.Printf("Error sending push to %s: %v", s.ID.Hex(), err)
-			} else {
-				log.Printf("Push sent to subscription %s", s.ID.Hex())
-			}
-		}(sub)
+func (q *Queue) sendPush(sub models.PushSubscription, pushTexts i18n.PushNotificationTexts, language string, url string, d *delivery) {
+	if d.interrupted() {
+		return
+	}
+	result := models.DeliveryResult{
+		Channel:        models.ChannelPush,
+		UserID:         sub.UserID.Hex(),
+		SubscriptionID: sub.ID.Hex(),
+		Language:       language,
 	}
-}
 
-func (q *Queue) processNewRecipeNotification(notification models.Notification) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if d.dryRun {
+		log.Printf("Dry run: would push %q to subscription %s", pushTexts.Title, sub.ID.Hex())
+		result.Title = pushTexts.Title
+		d.recordError(result, nil)
+		return
+	}
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
+	err := q.pushSender.SendNotification(sub, pushTexts.Title, pushTexts.Message, url)
 	if err != nil {
-		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
+		log.Printf("Error sending push to %s: %v", sub.ID.Hex(), err)
 	} else {
-		log.Printf("Sending new recipe notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-
-			language := i18n.GetUserLanguage(&user)
+		log.Printf("Push sent to subscription %s", sub.ID.Hex())
+	}
+	d.recordError(result, err)
+}
 
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
+// sendPushInUserLanguage looks up the owner of a subscription to send the push
+// in their language, falling back to Spanish.
+func (q *Queue) sendPushInUserLanguage(sub models.PushSubscription, notification models.Notification, url string, d *delivery) {
+	userCtx, userCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer userCancel()
 
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		log.Printf("New recipe email results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
+	user, err := q.users.GetUserByID(userCtx, sub.UserID.Hex())
+	var language string = "es"
+	if err != nil {
+		log.Printf("Error fetching user %s for push notification: %v (using default language)", sub.UserID.Hex(), err)
+	} else {
+		language = i18n.GetUserLanguage(user)
 	}
 
-	q.broadcastPushNotificationMultiLang(notification, "/recipes/"+notification.Metadata["slug"])
-
-	return emailSuccess
+	pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
+	q.sendPush(sub, pushTexts, language, url, d)
 }
 
-func (q *Queue) processMentionInCommentNotification(notification models.Notification) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (q *Queue) broadcastPushNotificationMultiLang(notification models.Notification, url string, d *delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	users, err := q.mongoDB.GetUsersMentionedInComment(ctx, notification.Metadata["mentionedUsers"], notification.Recipient)
-	var emailSuccess bool
+	subs, err := q.users.GetAllPushSubscriptions(ctx)
 	if err != nil {
-		log.Printf("Error fetching users for mention notification %s: %v", notification.ID, err)
-		emailSuccess = false
-	} else {
-		log.Printf("Sending mention in comment notification to %d users", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		log.Printf("Mention in comment email results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
+		log.Printf("Error fetching push subscriptions for broadcast: %v", err)
+		d.recordError(models.DeliveryResult{Channel: models.ChannelPush}, err)
+		return
 	}
 
-	mentionedUserIDsStr := notification.Metadata["mentionedUsers"]
-	if mentionedUserIDsStr != "" {
-		ids := strings.Split(mentionedUserIDsStr, ",")
-		q.sendPushToUsersMultiLang(ids, notification, "/recipes/"+notification.Metadata["recipeId"])
+	for _, sub := range d.unpushed(subs) {
+		d.send(func() {
+			q.sendPushInUserLanguage(sub, notification, url, d)
+		})
 	}
-
-	return emailSuccess
 }
 
-func (q *Queue) processNewBlogNotification(notification models.Notification) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (q *Queue) sendPushToUsersMultiLang(userIDs []string, notification models.Notification, url string, d *delivery) {
+	if len(userIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
+	subs, err := q.users.GetPushSubscriptionsForUsers(ctx, userIDs)
 	if err != nil {
-		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
-	} else {
-		log.Printf("Sending new blog notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		log.Printf("New blog notification results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
+		log.Printf("Error fetching push subscriptions for users: %v", err)
+		d.recordError(models.DeliveryResult{Channel: models.ChannelPush}, err)
+		return
 	}
 
-	q.broadcastPushNotificationMultiLang(notification, "/blog/"+notification.Metadata["blog_id"])
+	log.Printf("Found %d push subscriptions for users %v", len(subs), userIDs)
 
-	return emailSuccess
+	for _, sub := range d.unpushed(subs) {
+		d.send(func() {
+			q.sendPushInUserLanguage(sub, notification, url, d)
+		})
+	}
 }
 
-func (q *Queue) processNewEventNotification(notification models.Notification) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// sendEmailsToUsers emails every user of a broadcast one at a time, in their
+// own language, skipping those an earlier attempt already emailed.
+func (q *Queue) sendEmailsToUsers(notification models.Notification, users []models.User, d *delivery) error {
+	successCount := 0
+	failCount := 0
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
-	if err != nil {
-		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
-	} else {
-		log.Printf("Sending new event notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
+	for _, user := range users {
+		if d.interrupted() {
+			log.Printf("%s emails interrupted by shutdown after %d successful, %d failed", notification.Type, successCount, failCount)
+			return errInterrupted
+		}
+		if d.emailed(user.Email) {
+			successCount++
+			continue
 		}
-		log.Printf("New event notification results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
-	}
-
-	q.broadcastPushNotificationMultiLang(notification, "/events/"+notification.Metadata["eventId"])
 
-	return emailSuccess
-}
+		userNotification := models.Notification{
+			ID:        uuid.New().String(),
+			Type:      notification.Type,
+			Status:    models.StatusProcessing,
+			Recipient: user.Email,
+			Metadata:  notification.Metadata,
+		}
 
-func (q *Queue) processEventEndingSoonNotification(notification models.Notification) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+		language := i18n.GetUserLanguage(&user)
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
-	if err != nil {
-		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
-	} else {
-		log.Printf("Sending event ending soon notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
+		subject, err := q.deliverEmail(userNotification, language, d)
+		if err != nil {
+			log.Printf("Error sending email to %s: %v", user.Email, err)
+			failCount++
+		} else {
+			successCount++
+		}
+		d.recordError(models.DeliveryResult{
+			Channel:   models.ChannelEmail,
+			Recipient: user.Email,
+			UserID:    user.ID.Hex(),
+			Language:  language,
+			Title:     subject,
+		}, err)
+		if !d.dryRun {
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-d.ctx.Done():
 			}
-			time.Sleep(100 * time.Millisecond)
 		}
-		log.Printf("Event ending soon notification results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
 	}
 
-	q.broadcastPushNotificationMultiLang(notification, "/events/"+notification.Metadata["eventId"])
-
-	return emailSuccess
+	log.Printf("%s email results: %d successful, %d failed", notification.Type, successCount, failCount)
+	return broadcastEmailError(successCount, failCount)
 }
 
-func (q *Queue) processNewQuestNotification(notification models.Notification) bool {
+// broadcast emails every user with notifications enabled and pushes to every
+// subscription.
+func (q *Queue) broadcast(notification models.Notification, url string, d *delivery) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
+	users, err := q.users.GetUsersWithNotificationsEnabled(ctx)
+	var emailErr error
 	if err != nil {
 		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
+		emailErr = err
 	} else {
-		log.Printf("Sending new quest notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		log.Printf("New quest notification results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
+		log.Printf("Sending %s notification to %d users with notifications enabled", notification.Type, len(users))
+		emailErr = q.sendEmailsToUsers(notification, users, d)
 	}
 
-	q.broadcastPushNotificationMultiLang(notification, "/quests/"+notification.Metadata["questId"])
+	q.broadcastPushNotificationMultiLang(notification, url, d)
 
-	return emailSuccess
+	return emailErr
 }
 
-func (q *Queue) processNewChallengeNotification(notification models.Notification) bool {
-	if desc, ok := notification.Metadata["description"]; ok {
-		notification.Metadata["description"] = strings.ReplaceAll(desc, "_", " ")
-	}
-
+func (q *Queue) processMentionInCommentNotification(notification models.Notification, d *delivery) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	users, err := q.mongoDB.GetUsersWithNotificationsEnabled(ctx)
-	var emailSuccess bool
+	users, err := q.users.GetUsersMentionedInComment(ctx, notification.Metadata["mentionedUsers"], notification.Recipient)
+	var emailErr error
 	if err != nil {
-		log.Printf("Error fetching users for notification %s: %v", notification.ID, err)
-		emailSuccess = false
+		log.Printf("Error fetching users for mention notification %s: %v", notification.ID, err)
+		emailErr = err
 	} else {
-		log.Printf("Sending new challenge notification to %d users with notifications enabled", len(users))
-		successCount := 0
-		failCount := 0
-		for _, user := range users {
-			userNotification := models.Notification{
-				ID:        uuid.New().String(),
-				Type:      notification.Type,
-				Status:    models.StatusProcessing,
-				Recipient: user.Email,
-				Metadata:  notification.Metadata,
-			}
-			language := i18n.GetUserLanguage(&user)
-			success, err := q.emailSender.SendNotificationEmail(userNotification, language)
-			if err != nil {
-				log.Printf("Error sending email to %s: %v", user.Email, err)
-				failCount++
-				continue
-			}
-			if success {
-				successCount++
-			} else {
-				failCount++
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		log.Printf("New challenge notification results: %d successful, %d failed", successCount, failCount)
-		emailSuccess = successCount > 0
+		log.Printf("Sending mention in comment notification to %d users", len(users))
+		emailErr = q.sendEmailsToUsers(notification, users, d)
 	}
 
-	q.broadcastPushNotificationMultiLang(notification, "/events")
+	mentionedUserIDsStr := notification.Metadata["mentionedUsers"]
+	if mentionedUserIDsStr != "" {
+		ids := strings.Split(mentionedUserIDsStr, ",")
+		q.sendPushToUsersMultiLang(ids, notification, pushURL(notification), d)
+	}
 
-	return emailSuccess
+	return emailErr
 }
 
-func (q *Queue) processNewBadgeNotification(notification models.Notification) bool {
+func (q *Queue) processNewBadgeNotification(notification models.Notification, d *delivery) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	user, err := q.mongoDB.GetUserByEmail(ctx, notification.Recipient)
+	user, err := q.users.GetUserByEmail(ctx, notification.Recipient)
 	if err != nil {
 		log.Printf("Error fetching user for recipient %s: %v", notification.Recipient, err)
-		return false
+		return recipientLookupError(err)
 	}
 
 	language := i18n.GetUserLanguage(user)
-	var success bool = true
 
-	if notification.Metadata == nil {
-		notification.Metadata = make(map[string]string)
-	}
 	notification.Metadata["userId"] = user.ID.Hex()
-	if badge_name, ok := notification.Metadata["badgeName"]; ok && strings.Contains(badge_name, "_") {
-		notification.Metadata["badgeName"] = strings.ToUpper(strings.ReplaceAll(badge_name, "_", " "))
-	}
-	if user.EmailNotifications {
-		success, err = q.emailSender.SendNotificationEmail(notification, language)
-		if err != nil {
-			log.Printf("Error sending email for notification %s: %v", notification.ID, err)
-			success = false
-		}
-	} else {
-		log.Printf("Skipping email for %s (notifications disabled)", notification.Recipient)
-	}
-
-	pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
-	userID := user.ID.Hex()
-	url := "/profile/" + userID
-
-	if pushTexts.Title != "" {
-		log.Printf("Sending push notification '%s' to user %s", pushTexts.Title, userID)
-
-		subsCtx, subsCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer subsCancel()
-
-		subs, err := q.mongoDB.GetPushSubscriptionsForUsers(subsCtx, []string{userID})
-		if err != nil {
-			log.Printf("Error fetching push subscriptions for user %s: %v", userID, err)
-		} else {
-			log.Printf("Found %d push subscriptions for user %s", len(subs), userID)
-			for _, sub := range subs {
-				go func(s models.PushSubscription) {
-					if err := q.pushSender.SendNotification(s, pushTexts.Title, pushTexts.Message, url); err != nil {
-						log.Printf("Error sending push to %s: %v", s.ID.Hex(), err)
-					} else {
-						log.Printf("Push sent to subscription %s", s.ID.Hex())
-					}
-				}(sub)
-			}
-		}
-	} else {
-		log.Printf("No push notification title set for type %s", notification.Type)
-	}
 
-	return success
+	return q.sendToUser(notification, user, language, pushURL(notification), d)
 }
 
-func (q *Queue) processVerifiedNotification(notification models.Notification) bool {
+func (q *Queue) processVerifiedNotification(notification models.Notification, d *delivery) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	user, err := q.mongoDB.GetUserByEmail(ctx, notification.Recipient)
+	user, err := q.users.GetUserByEmail(ctx, notification.Recipient)
 	if err != nil {
 		log.Printf("Error fetching user for recipient %s: %v", notification.Recipient, err)
-		return false
+		return recipientLookupError(err)
 	}
 
 	language := i18n.GetUserLanguage(user)
-	var success bool = true
 
-	if notification.Metadata == nil {
-		notification.Metadata = make(map[string]string)
-	}
 	notification.Metadata["userId"] = user.ID.Hex()
 
-	if user.EmailNotifications {
-		success, err = q.emailSender.SendNotificationEmail(notification, language)
-		if err != nil {
-			log.Printf("Error sending email for notification %s: %v", notification.ID, err)
-			success = false
-		}
-	} else {
-		log.Printf("Skipping email for %s (notifications disabled)", notification.Recipient)
-	}
-
-	pushTexts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
-	userID := user.ID.Hex()
-	url := "/profile/" + userID
-
-	if pushTexts.Title != "" {
-		log.Printf("Sending push notification '%s' to user %s", pushTexts.Title, userID)
-
-		subsCtx, subsCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer subsCancel()
-
-		subs, err := q.mongoDB.GetPushSubscriptionsForUsers(subsCtx, []string{userID})
-		if err != nil {
-			log.Printf("Error fetching push subscriptions for user %s: %v", userID, err)
-		} else {
-			log.Printf("Found %d push subscriptions for user %s", len(subs), userID)
-			for _, sub := range subs {
-				go func(s models.PushSubscription) {
-					if err := q.pushSender.SendNotification(s, pushTexts.Title, pushTexts.Message, url); err != nil {
-						log.Printf("Error sending push to %s: %v", s.ID.Hex(), err)
-					} else {
-						log.Printf("Push sent to subscription %s", s.ID.Hex())
-					}
-				}(sub)
-			}
-		}
-	} else {
-		log.Printf("No push notification title set for type %s", notification.Type)
-	}
-
-	return success
+	return q.sendToUser(notification, user, language, pushURL(notification), d)
 }
@@ -0,0 +1,605 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+	"github.com/jorbush/jorbites-notifier/internal/webhook"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newTestQueue() *Queue {
+	return &Queue{
+		store:          NewMemoryStore(),
+		deadLetters:    NewMemoryDeadLetterStore(),
+		idempotency:    NewMemoryIdempotencyStore(),
+		notifyChan:     make(chan struct{}, 1),
+		stopping:       make(chan struct{}),
+		inFlight:       make(map[string]inFlightJob),
+		interruptGrace: defaultInterruptGrace,
+		events:         NewEventBus(),
+	}
+}
+
+func TestNextClaimOrderFairShare(t *testing.T) {
+	q := &Queue{fairShare: 3}
+
+	var orders []ClaimOrder
+	for i := 0; i < 6; i++ {
+		orders = append(orders, q.nextClaimOrder())
+	}
+
+	expected := []ClaimOrder{ClaimByPriority, ClaimByPriority, ClaimOldestFirst, ClaimByPriority, ClaimByPriority, ClaimOldestFirst}
+	for i := range expected {
+		if orders[i] != expected[i] {
+			t.Fatalf("nextClaimOrder() sequence = %v, want %v", orders, expected)
+		}
+	}
+}
+
+func TestEnqueueHoldsBackScheduledNotifications(t *testing.T) {
+	q := newTestQueue()
+	ctx := context.Background()
+
+	delayed, err := q.Enqueue(models.Notification{Type: models.TypeEventEndingSoon, DelaySeconds: 3600})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if delayed.SendAt == nil || delayed.NextAttemptAt == nil || delayed.DelaySeconds != 0 {
+		t.Fatalf("Enqueue() with delaySeconds = %+v, want sendAt and nextAttemptAt set", delayed)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	immediate, _ := q.Enqueue(models.Notification{Type: models.TypeNewLike, SendAt: &past})
+	if immediate.NextAttemptAt != nil {
+		t.Errorf("Enqueue() with past sendAt set nextAttemptAt = %v, want nil", immediate.NextAttemptAt)
+	}
+
+	n, _ := q.store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+	if n == nil || n.ID != immediate.ID {
+		t.Errorf("Claim() = %+v, want the notification that is already due", n)
+	}
+	if n, _ := q.store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst); n != nil {
+		t.Errorf("Claim() returned scheduled notification %s before sendAt", n.ID)
+	}
+}
+
+func TestEnqueueDeduplicatesIdempotencyKeys(t *testing.T) {
+	q := newTestQueue()
+	q.idempotencyTTL = time.Hour
+
+	first, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-1"})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	second, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-1"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Enqueue() with repeated key error = %v, want ErrDuplicate", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Enqueue() with repeated key returned ID %s, want original %s", second.ID, first.ID)
+	}
+
+	if page, _ := q.GetQueueStatus(ListFilter{}); page.Summary.Total != 1 {
+		t.Errorf("queue size = %d, want 1", page.Summary.Total)
+	}
+
+	if _, err := q.Enqueue(models.Notification{Type: models.TypeNewComment, IdempotencyKey: "like-1"}); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Enqueue() of a different notification with a used key error = %v, want ErrIdempotencyConflict", err)
+	}
+
+	other, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-1", Owner: "other"})
+	if err != nil || other.ID == first.ID {
+		t.Errorf("Enqueue() by another client with the same key = %s, %v, want a new notification", other.ID, err)
+	}
+
+	q.idempotencyTTL = -time.Second
+	q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-2"})
+	if _, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-2"}); err != nil {
+		t.Errorf("Enqueue() after window expired error = %v, want nil", err)
+	}
+}
+
+func TestCancelNotification(t *testing.T) {
+	q := newTestQueue()
+	q.retention = time.Hour
+	ctx := context.Background()
+
+	pending, _ := q.Enqueue(models.Notification{Type: models.TypeNewComment})
+	claimed, _ := q.Enqueue(models.Notification{Type: models.TypeNewLike})
+
+	cancelled, err := q.CancelNotification(pending.ID)
+	if err != nil {
+		t.Fatalf("CancelNotification() error = %v", err)
+	}
+	if cancelled.Status != models.StatusCancelled {
+		t.Errorf("CancelNotification() status = %s, want cancelled", cancelled.Status)
+	}
+
+	n, _ := q.store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+	if n == nil || n.ID != claimed.ID {
+		t.Fatalf("Claim() = %+v, want %s and not the cancelled notification", n, claimed.ID)
+	}
+
+	if n, err := q.CancelNotification(claimed.ID); !errors.Is(err, ErrNotPending) || n.Status != models.StatusProcessing {
+		t.Errorf("CancelNotification() on claimed notification = %+v, %v, want processing and ErrNotPending", n, err)
+	}
+	if _, err := q.CancelNotification(pending.ID); !errors.Is(err, ErrNotPending) {
+		t.Errorf("CancelNotification() twice error = %v, want ErrNotPending", err)
+	}
+	if _, err := q.CancelNotification("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CancelNotification() on unknown ID error = %v, want ErrNotFound", err)
+	}
+
+	if got, _ := q.GetNotification(pending.ID); got == nil || got.Status != models.StatusCancelled {
+		t.Errorf("GetNotification() after cancel = %+v, want cancelled", got)
+	}
+}
+
+func TestShutdownCheckpointsInFlightNotifications(t *testing.T) {
+	q := newTestQueue()
+	ctx := context.Background()
+
+	q.interruptGrace = time.Millisecond
+
+	n, _ := q.Enqueue(models.Notification{Type: models.TypeNewLike})
+	claimed, _ := q.store.Claim(ctx, "worker", time.Minute, ClaimOldestFirst)
+	deliveryCtx, interrupt := context.WithCancel(ctx)
+	d := newDelivery(deliveryCtx, false, nil)
+	d.recordError(models.DeliveryResult{Channel: models.ChannelEmail, Recipient: "user@example.com"}, nil)
+	q.track(claimed.ID, inFlightJob{
+		owner:    "worker",
+		attempt:  models.Attempt{Number: claimed.Attempts, StartedAt: time.Now().UTC()},
+		delivery: d,
+		cancel:   interrupt,
+	})
+
+	// A worker stuck in a send keeps Shutdown waiting past the deadline and
+	// the grace period.
+	q.workers.Add(1)
+	defer q.workers.Done()
+
+	expired, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	if !d.interrupted() {
+		t.Error("Shutdown() didn't interrupt the delivery")
+	}
+	got, _ := q.GetNotification(n.ID)
+	if got.Status != models.StatusPending || got.LeaseOwner != "" || len(got.History) != 1 {
+		t.Errorf("notification after Shutdown = %+v, want pending with the interrupted attempt recorded", got)
+	}
+	if got.Delivery == nil || got.Delivery.Email.Sent != 1 {
+		t.Errorf("delivery report after Shutdown = %+v, want the email sent before the deadline", got.Delivery)
+	}
+
+	if _, err := q.Enqueue(models.Notification{Type: models.TypeNewLike}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Enqueue() after Shutdown error = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	q := newTestQueue()
+	q.idempotencyTTL = time.Hour
+
+	existing, _ := q.Enqueue(models.Notification{Type: models.TypeNewBadge, IdempotencyKey: "badge-1"})
+
+	results, err := q.EnqueueBatch([]models.Notification{
+		{Type: models.TypeNewBadge, Recipient: "a@example.com"},
+		{Type: models.TypeNewBadge, IdempotencyKey: "badge-1"},
+		{Type: models.TypeNewBadge, IdempotencyKey: "badge-2"},
+		{Type: models.TypeNewBadge, IdempotencyKey: "badge-2"},
+		{Type: models.TypeVerified, IdempotencyKey: "badge-2"},
+	})
+	if err != nil {
+		t.Fatalf("EnqueueBatch() error = %v", err)
+	}
+
+	duplicates := []bool{false, true, false, true, true}
+	for i, result := range results {
+		if result.Duplicate != duplicates[i] {
+			t.Errorf("result %d Duplicate = %t, want %t", i, result.Duplicate, duplicates[i])
+		}
+		if result.Conflict != (i == 4) {
+			t.Errorf("result %d Conflict = %t, want %t", i, result.Conflict, i == 4)
+		}
+	}
+	if results[1].Notification.ID != existing.ID {
+		t.Errorf("duplicate of an earlier key returned ID %s, want %s", results[1].Notification.ID, existing.ID)
+	}
+	if results[3].Notification.ID != results[2].Notification.ID {
+		t.Errorf("duplicate key within the batch returned ID %s, want %s", results[3].Notification.ID, results[2].Notification.ID)
+	}
+
+	page, _ := q.GetQueueStatus(ListFilter{})
+	if page.Summary.Total != 3 {
+		t.Errorf("queue holds %d notifications, want 3", page.Summary.Total)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	q := newTestQueue()
+	q.idempotencyTTL = time.Hour
+	q.dryRun = true
+
+	n, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-1"})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if !n.DryRun {
+		t.Error("Enqueue() with DRY_RUN set didn't mark the notification as a dry run")
+	}
+	if _, err := q.Enqueue(models.Notification{Type: models.TypeNewLike, IdempotencyKey: "like-1"}); err != nil {
+		t.Errorf("Enqueue() of a second dry run with the same key error = %v, want the key left unused", err)
+	}
+
+	d := newDelivery(context.Background(), true, nil)
+	notification := models.Notification{
+		Type:      models.TypeNewLike,
+		Recipient: "user@example.com",
+		Metadata:  map[string]string{"likedBy": "User2", "recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"},
+	}
+	if err := q.sendEmail(notification, "65a1b2c3d4e5f6a7b8c9d0c1", "en", d); err != nil {
+		t.Fatalf("sendEmail() in a dry run error = %v", err)
+	}
+
+	report := d.Report()
+	if report.Email.DryRun != 1 || report.Email.Sent != 0 {
+		t.Fatalf("report = %+v, want one dry-run email", report.Email)
+	}
+	result := report.Results[0]
+	if result.Status != models.DeliveryDryRun || result.Recipient != "user@example.com" || result.Language != "en" || result.Title == "" {
+		t.Errorf("dry-run result = %+v, want the recipient, language and subject", result)
+	}
+}
+
+type fakeMailer struct {
+	mutex sync.Mutex
+	errs  []error
+	sent  []string
+	// onSend, if set, is called before each email is sent.
+	onSend func(recipient string)
+}
+
+func (m *fakeMailer) SendNotificationEmail(notification models.Notification, language string) (bool, error) {
+	if m.onSend != nil {
+		m.onSend(notification.Recipient)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sent = append(m.sent, notification.Recipient)
+	if len(m.errs) == 0 {
+		return true, nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err == nil, err
+}
+
+type fakePusher struct {
+	mutex sync.Mutex
+	sent  []string
+}
+
+func (p *fakePusher) SendNotification(subscription models.PushSubscription, title, message, url string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.sent = append(p.sent, subscription.ID.Hex())
+	return nil
+}
+
+// fakeDirectory holds users and their push subscriptions.
+type fakeDirectory struct {
+	users []models.User
+	subs  []models.PushSubscription
+}
+
+func (f *fakeDirectory) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (f *fakeDirectory) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.ID.Hex() == id {
+			return &user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (f *fakeDirectory) GetUsersWithNotificationsEnabled(ctx context.Context) ([]models.User, error) {
+	return f.users, nil
+}
+
+func (f *fakeDirectory) GetUsersMentionedInComment(ctx context.Context, mentionedUsersIds string, recipientEmail string) ([]models.User, error) {
+	return f.users, nil
+}
+
+func (f *fakeDirectory) GetAllPushSubscriptions(ctx context.Context) ([]models.PushSubscription, error) {
+	return f.subs, nil
+}
+
+func (f *fakeDirectory) GetPushSubscriptionsForUsers(ctx context.Context, userIDs []string) ([]models.PushSubscription, error) {
+	return f.subs, nil
+}
+
+// newDeliveringQueue returns a test queue that delivers to users through
+// fakes, retrying failures straight away. Each user has a push subscription.
+func newDeliveringQueue(users ...models.User) (*Queue, *fakeMailer, *fakePusher) {
+	q := newTestQueue()
+	mailer := &fakeMailer{}
+	pusher := &fakePusher{}
+	q.emailSender = mailer
+	q.pushSender = pusher
+	directory := &fakeDirectory{users: users}
+	for _, user := range users {
+		directory.subs = append(directory.subs, models.PushSubscription{ID: bson.NewObjectID(), UserID: user.ID})
+	}
+	q.users = directory
+	q.leaseDuration = time.Minute
+	q.retention = time.Hour
+	q.retryPolicy = RetryPolicy{MaxAttempts: 3}
+	return q, mailer, pusher
+}
+
+func TestRetryOnlyResendsFailedDeliveries(t *testing.T) {
+	user := models.User{ID: bson.NewObjectID(), Email: "user@example.com", EmailNotifications: true}
+	q, mailer, pusher := newDeliveringQueue(user)
+	mailer.errs = []error{errors.New("smtp timeout")}
+
+	n, _ := q.Enqueue(models.Notification{
+		Type:      models.TypeNewLike,
+		Recipient: user.Email,
+		Metadata:  map[string]string{"likedBy": "User2", "recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"},
+	})
+
+	if !q.processNextNotification("worker") {
+		t.Fatal("processNextNotification() found nothing to process")
+	}
+	retried, _ := q.GetNotification(n.ID)
+	if retried.Status != models.StatusPending || retried.Delivery == nil || retried.Delivery.Push.Sent != 1 || retried.Delivery.Email.Failed != 1 {
+		t.Fatalf("notification after a failed email = %+v, want pending with the push recorded as sent", retried)
+	}
+
+	if !q.processNextNotification("worker") {
+		t.Fatal("processNextNotification() didn't retry the notification")
+	}
+	if len(mailer.sent) != 2 {
+		t.Errorf("emails sent = %d, want 2", len(mailer.sent))
+	}
+	if len(pusher.sent) != 1 {
+		t.Errorf("pushes sent = %d, want 1: the retry sent the push again", len(pusher.sent))
+	}
+
+	completed, _ := q.GetNotification(n.ID)
+	report := completed.Delivery
+	if completed.Status != models.StatusSent || report.Email.Sent != 1 || report.Email.Failed != 0 || report.Push.Sent != 1 || len(report.Results) != 2 {
+		t.Errorf("notification after the retry = %s %+v, want sent with one email and one push", completed.Status, report)
+	}
+}
+
+func TestInterruptsDontUseUpAttempts(t *testing.T) {
+	user := models.User{ID: bson.NewObjectID(), Email: "user@example.com", EmailNotifications: true}
+	q, mailer, _ := newDeliveringQueue(user)
+	q.retryPolicy = RetryPolicy{MaxAttempts: 2}
+
+	n, _ := q.Enqueue(models.Notification{Type: models.TypeNotificationsActivated, Recipient: user.Email})
+	for i := 0; i < 5; i++ {
+		claimed, _ := q.store.Claim(context.Background(), "worker", time.Minute, ClaimOldestFirst)
+		if claimed == nil || claimed.Attempts != 1 {
+			t.Fatalf("claim after %d interrupts = %+v, want attempt 1", i, claimed)
+		}
+		q.checkpointJob(claimed.ID, inFlightJob{
+			owner:    "worker",
+			attempt:  models.Attempt{Number: claimed.Attempts, StartedAt: time.Now().UTC()},
+			delivery: newDelivery(context.Background(), false, claimed.Delivery),
+		})
+	}
+
+	q.processNextNotification("worker")
+	got, _ := q.GetNotification(n.ID)
+	if got.Status != models.StatusSent || len(mailer.sent) != 1 {
+		t.Fatalf("notification after five interrupts = %s with emails to %v, want sent once", got.Status, mailer.sent)
+	}
+	if len(got.History) != 5 || !got.History[4].Interrupted {
+		t.Errorf("history = %+v, want the five interrupted attempts", got.History)
+	}
+	if dead, _ := q.ListDeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters = %+v, want none", dead)
+	}
+}
+
+func TestShutdownInterruptsBroadcast(t *testing.T) {
+	var users []models.User
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		users = append(users, models.User{ID: bson.NewObjectID(), Email: email, EmailNotifications: true})
+	}
+	q, mailer, pusher := newDeliveringQueue(users...)
+
+	// The second email is still being sent when the shutdown deadline
+	// passes, and finishes once the worker has been interrupted.
+	sending := make(chan struct{})
+	interrupted := make(chan struct{})
+	mailer.onSend = func(recipient string) {
+		if recipient == "b@example.com" {
+			close(sending)
+			<-interrupted
+		}
+	}
+
+	n, _ := q.Enqueue(models.Notification{Type: models.TypeNewRecipe, Metadata: map[string]string{"recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"}})
+	q.workers.Add(1)
+	go func() {
+		defer q.workers.Done()
+		q.processNextNotification("worker")
+	}()
+	<-sending
+
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	shutdown := make(chan error)
+	go func() { shutdown <- q.Shutdown(expired) }()
+	for {
+		q.mutex.Lock()
+		job, ok := q.inFlight[n.ID]
+		q.mutex.Unlock()
+		if !ok || job.delivery.interrupted() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(interrupted)
+	if err := <-shutdown; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Shutdown() error = %v, want context.Canceled", err)
+	}
+
+	if len(mailer.sent) != 2 || len(pusher.sent) != 0 {
+		t.Fatalf("sent emails to %v and %d pushes after the deadline, want only the first two emails", mailer.sent, len(pusher.sent))
+	}
+	got, _ := q.GetNotification(n.ID)
+	if got.Status != models.StatusPending || got.Delivery == nil || got.Delivery.Email.Sent != 2 {
+		t.Fatalf("notification after Shutdown = %s %+v, want pending with two emails sent", got.Status, got.Delivery)
+	}
+
+	// The next instance resumes where the interrupted one stopped.
+	q.processNextNotification("worker")
+	if len(mailer.sent) != 3 || mailer.sent[2] != "c@example.com" || len(pusher.sent) != 3 {
+		t.Errorf("resumed broadcast sent emails to %v and %d pushes, want only c@example.com and every push", mailer.sent, len(pusher.sent))
+	}
+	if got, _ := q.GetNotification(n.ID); got.Status != models.StatusSent || got.Delivery.Email.Sent != 3 {
+		t.Errorf("resumed notification = %s %+v, want sent with three emails", got.Status, got.Delivery)
+	}
+}
+
+type fakeCallbackSender struct {
+	mutex    sync.Mutex
+	errs     []error
+	payloads []webhook.Payload
+	urls     []string
+}
+
+func (s *fakeCallbackSender) Send(ctx context.Context, url string, deliveryID string, payload webhook.Payload) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.urls = append(s.urls, url)
+	s.payloads = append(s.payloads, payload)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestSendCallbackRetries(t *testing.T) {
+	q := newTestQueue()
+	sender := &fakeCallbackSender{errs: []error{errors.New("connection refused"), &webhook.StatusError{StatusCode: 503}}}
+	q.callbacks = sender
+	q.webhookURL = "https://jorbites.com/api/notifier"
+	q.callbackRetry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+
+	report := &models.DeliveryReport{}
+	report.Add(models.DeliveryResult{Channel: models.ChannelEmail, Status: models.DeliverySent})
+	q.sendCallback(models.Notification{ID: "n1", Type: models.TypeForgotPassword}, models.StatusSent, report, "")
+	q.pendingCallbacks.Wait()
+
+	if len(sender.payloads) != 3 {
+		t.Fatalf("Send() called %d times, want 3", len(sender.payloads))
+	}
+	last := sender.payloads[2]
+	if sender.urls[2] != q.webhookURL || last.Status != models.StatusSent || last.Delivery.Email.Sent != 1 {
+		t.Errorf("last callback = %s %+v, want the sent report on the webhook URL", sender.urls[2], last)
+	}
+}
+
+func TestSendCallbackStopsOnRejection(t *testing.T) {
+	q := newTestQueue()
+	sender := &fakeCallbackSender{errs: []error{&webhook.StatusError{StatusCode: 400}}}
+	q.callbacks = sender
+	q.callbackHosts = webhook.NewAllowList(&config.Config{WebhookAllowedHosts: "example.com"})
+	q.callbackRetry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+
+	q.sendCallback(models.Notification{ID: "n1", CallbackURL: "https://example.com/hook"}, models.StatusFailed, nil, "boom")
+	q.pendingCallbacks.Wait()
+
+	if len(sender.payloads) != 1 || sender.urls[0] != "https://example.com/hook" {
+		t.Errorf("Send() calls = %v, want a single call to the notification's callback URL", sender.urls)
+	}
+
+	q.sendCallback(models.Notification{ID: "n2"}, models.StatusSent, nil, "")
+	q.pendingCallbacks.Wait()
+	if len(sender.payloads) != 1 {
+		t.Errorf("Send() called without any callback URL")
+	}
+}
+
+func TestSendCallbackSkipsHostsNotAllowed(t *testing.T) {
+	q := newTestQueue()
+	sender := &fakeCallbackSender{}
+	q.callbacks = sender
+	q.webhookURL = "https://jorbites.com/api/notifier"
+	q.callbackHosts = webhook.NewAllowList(&config.Config{WebhookURL: q.webhookURL})
+	q.callbackRetry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+
+	q.sendCallback(models.Notification{ID: "n1", CallbackURL: "http://169.254.169.254/latest/meta-data"}, models.StatusSent, nil, "")
+	q.pendingCallbacks.Wait()
+	if len(sender.urls) != 0 {
+		t.Errorf("Send() calls = %v, want none for a host that is not allowed", sender.urls)
+	}
+
+	q.sendCallback(models.Notification{ID: "n2", CallbackURL: "https://jorbites.com/api/other"}, models.StatusSent, nil, "")
+	q.pendingCallbacks.Wait()
+	if len(sender.urls) != 1 {
+		t.Errorf("Send() calls = %v, want one to the host of WEBHOOK_URL", sender.urls)
+	}
+}
+
+func TestSendCallbackSkipsDryRuns(t *testing.T) {
+	q := newTestQueue()
+	sender := &fakeCallbackSender{}
+	q.callbacks = sender
+	q.webhookURL = "https://jorbites.com/api/notifier"
+
+	q.sendCallback(models.Notification{ID: "n1", DryRun: true}, models.StatusDryRun, nil, "")
+	q.dryRun = true
+	q.sendCallback(models.Notification{ID: "n2"}, models.StatusDryRun, nil, "")
+	q.pendingCallbacks.Wait()
+	if len(sender.urls) != 0 {
+		t.Errorf("Send() calls = %v, want none for dry runs", sender.urls)
+	}
+}
+
+func TestDepthCountsEnqueuedNotifications(t *testing.T) {
+	q := newTestQueue()
+	q.Enqueue(models.Notification{Type: models.TypeNewLike})
+
+	depth, err := q.Depth()
+	if err != nil {
+		t.Fatalf("Depth() error = %v", err)
+	}
+	if depth.Total != 1 || depth.ByType[models.TypeNewLike] != 1 {
+		t.Fatalf("Depth() = %+v, want one NEW_LIKE", depth)
+	}
+
+	// Until the next count, enqueued notifications are added to the cached
+	// depth.
+	q.EnqueueBatch([]models.Notification{{Type: models.TypeNewLike}, {Type: models.TypeNewRecipe}})
+	depth, _ = q.Depth()
+	if depth.Total != 3 || depth.ByType[models.TypeNewLike] != 2 || depth.ByType[models.TypeNewRecipe] != 1 {
+		t.Errorf("Depth() after a batch = %+v, want two NEW_LIKE and one NEW_RECIPE", depth)
+	}
+}
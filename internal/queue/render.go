@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"strings"
+
+	"github.com/jorbush/jorbites-notifier/internal/email"
+	"github.com/jorbush/jorbites-notifier/internal/i18n"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// RenderedEmail is the email a notification produces in one language.
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+}
+
+// RenderedPush is the push notification a notification produces in one
+// language.
+type RenderedPush struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// Rendered holds what a notification looks like on each of its channels.
+// Push is nil for types that are only emailed.
+type Rendered struct {
+	Language string        `json:"language"`
+	Email    RenderedEmail `json:"email"`
+	Push     *RenderedPush `json:"push,omitempty"`
+}
+
+// Render produces the email and push content of a notification in language
+// exactly as processing would, without sending anything.
+func Render(notification models.Notification, language string) (Rendered, error) {
+	notification = normalizeMetadata(notification)
+
+	subject, html, err := email.GetEmailTemplate(notification.Type, notification.Metadata, language)
+	if err != nil {
+		return Rendered{}, err
+	}
+
+	rendered := Rendered{
+		Language: language,
+		Email:    RenderedEmail{Subject: subject, HTML: html},
+	}
+
+	if schema, ok := models.SchemaFor(notification.Type); !ok || hasChannel(schema, models.ChannelPush) {
+		texts := i18n.GetPushNotificationText(notification.Type, language, notification.Metadata)
+		rendered.Push = &RenderedPush{
+			Title: texts.Title,
+			Body:  texts.Message,
+			URL:   pushURL(notification),
+		}
+	}
+
+	return rendered, nil
+}
+
+func hasChannel(schema models.NotificationSchema, channel models.Channel) bool {
+	for _, c := range schema.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMetadata returns the notification with a copy of its metadata in
+// the form the templates expect: underscores in challenge descriptions and
+// badge names become spaces.
+func normalizeMetadata(notification models.Notification) models.Notification {
+	metadata := make(map[string]string, len(notification.Metadata))
+	for key, value := range notification.Metadata {
+		metadata[key] = value
+	}
+
+	if desc, ok := metadata["description"]; ok && notification.Type == models.TypeNewChallenge {
+		metadata["description"] = strings.ReplaceAll(desc, "_", " ")
+	}
+	if badgeName, ok := metadata["badgeName"]; ok && strings.Contains(badgeName, "_") {
+		metadata["badgeName"] = strings.ToUpper(strings.ReplaceAll(badgeName, "_", " "))
+	}
+
+	notification.Metadata = metadata
+	return notification
+}
+
+// pushURL is the page a push notification opens.
+func pushURL(notification models.Notification) string {
+	switch notification.Type {
+	case models.TypeNewLike, models.TypeNewComment, models.TypeMentionInComment:
+		return "/recipes/" + notification.Metadata["recipeId"]
+	case models.TypeNewRecipe:
+		// The slug is optional; recipe pages are also served by ID.
+		if slug := notification.Metadata["slug"]; slug != "" {
+			return "/recipes/" + slug
+		}
+		return "/recipes/" + notification.Metadata["recipeId"]
+	case models.TypeNewBlog:
+		return "/blog/" + notification.Metadata["blog_id"]
+	case models.TypeNewEvent, models.TypeEventEndingSoon:
+		return "/events/" + notification.Metadata["eventId"]
+	case models.TypeNewQuest, models.TypeQuestFulfilled:
+		return "/quests/" + notification.Metadata["questId"]
+	case models.TypeNewChallenge:
+		return "/events"
+	case models.TypeNewBadge, models.TypeVerified:
+		return "/profile/" + notification.Metadata["userId"]
+	default:
+		return "/"
+	}
+}
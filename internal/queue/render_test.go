@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestRender(t *testing.T) {
+	metadata := map[string]string{"badgeName": "level_100", "userId": "65a1b2c3d4e5f6a7b8c9d0c1"}
+	rendered, err := Render(models.Notification{Type: models.TypeNewBadge, Metadata: metadata}, "en")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if rendered.Email.Subject == "" || !strings.Contains(rendered.Email.HTML, "LEVEL 100") {
+		t.Errorf("Render() email = %+v, want a subject and the normalized badge name", rendered.Email)
+	}
+	if rendered.Push == nil || rendered.Push.URL != "/profile/65a1b2c3d4e5f6a7b8c9d0c1" || !strings.Contains(rendered.Push.Body, "LEVEL 100") {
+		t.Errorf("Render() push = %+v, want the profile link and the normalized badge name", rendered.Push)
+	}
+	if metadata["badgeName"] != "level_100" {
+		t.Errorf("Render() modified the caller's metadata: %v", metadata)
+	}
+}
+
+func TestRenderEmailOnlyType(t *testing.T) {
+	rendered, err := Render(models.Notification{
+		Type:     models.TypeForgotPassword,
+		Metadata: map[string]string{"resetUrl": "https://jorbites.com/reset-password?token=abc123"},
+	}, "es")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if rendered.Push != nil {
+		t.Errorf("Render() push = %+v, want nil for an email-only type", rendered.Push)
+	}
+	if !strings.Contains(rendered.Email.HTML, "https://jorbites.com/reset-password?token=abc123") {
+		t.Error("Render() email doesn't contain the reset URL")
+	}
+}
+
+func TestPushURLNewRecipe(t *testing.T) {
+	tests := []struct {
+		metadata map[string]string
+		want     string
+	}{
+		{map[string]string{"recipeId": "65a1b2c3d4e5f6a7b8c9d0e1", "slug": "tortilla-de-patatas"}, "/recipes/tortilla-de-patatas"},
+		{map[string]string{"recipeId": "65a1b2c3d4e5f6a7b8c9d0e1"}, "/recipes/65a1b2c3d4e5f6a7b8c9d0e1"},
+	}
+	for _, tt := range tests {
+		if got := pushURL(models.Notification{Type: models.TypeNewRecipe, Metadata: tt.metadata}); got != tt.want {
+			t.Errorf("pushURL(%v) = %q, want %q", tt.metadata, got, tt.want)
+		}
+	}
+}
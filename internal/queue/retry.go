@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/database"
+)
+
+// RetryPolicy decides whether and when a failed notification is attempted
+// again. Delays grow exponentially from BaseDelay, are capped at MaxDelay and
+// are spread by up to ±Jitter (a fraction of the delay).
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// NewRetryPolicy reads the QUEUE_* retry settings. Every notification is
+// attempted at least once, so QUEUE_MAX_ATTEMPTS below 1 is raised to 1.
+func NewRetryPolicy(cfg *config.Config) RetryPolicy {
+	maxAttempts := cfg.QueueMaxAttempts
+	if maxAttempts < 1 {
+		log.Printf("QUEUE_MAX_ATTEMPTS=%d is below 1, using 1", maxAttempts)
+		maxAttempts = 1
+	}
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   cfg.QueueRetryBaseDelay,
+		MaxDelay:    cfg.QueueRetryMaxDelay,
+		Jitter:      cfg.QueueRetryJitter,
+	}
+}
+
+// ShouldRetry reports whether a notification that has already been attempted
+// attempts times and failed with err should be tried again.
+func (p RetryPolicy) ShouldRetry(attempts int, err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	return attempts < p.MaxAttempts
+}
+
+// Delay returns how long to wait before the attempt following the given one.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. a malformed notification.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// broadcastEmailError only reports a failure when every email of a broadcast
+// failed; retrying a partially delivered broadcast would resend it to
+// everyone who already received it.
+func broadcastEmailError(successCount, failCount int) error {
+	if successCount == 0 && failCount > 0 {
+		return fmt.Errorf("all %d emails failed", failCount)
+	}
+	return nil
+}
+
+// recipientLookupError wraps a user lookup failure, treating a missing user
+// as permanent since retrying will not make them appear.
+func recipientLookupError(err error) error {
+	err = fmt.Errorf("fetching recipient: %w", err)
+	if database.IsNotFound(err) {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 3, expected: 4 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempts); got != tt.expected {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		got := policy.Delay(1)
+		if got < 5*time.Second || got > 15*time.Second {
+			t.Fatalf("Delay(1) = %v, want within 5s..15s", got)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3}
+	transient := errors.New("smtp timeout")
+
+	if !policy.ShouldRetry(1, transient) {
+		t.Error("ShouldRetry() = false for first failed attempt, want true")
+	}
+	if policy.ShouldRetry(3, transient) {
+		t.Error("ShouldRetry() = true after max attempts, want false")
+	}
+	if policy.ShouldRetry(1, Permanent(transient)) {
+		t.Error("ShouldRetry() = true for permanent error, want false")
+	}
+}
+
+func TestNewRetryPolicyAttemptsAtLeastOnce(t *testing.T) {
+	for _, maxAttempts := range []int{0, -1} {
+		if got := NewRetryPolicy(&config.Config{QueueMaxAttempts: maxAttempts}).MaxAttempts; got != 1 {
+			t.Errorf("NewRetryPolicy() with QUEUE_MAX_ATTEMPTS=%d MaxAttempts = %d, want 1", maxAttempts, got)
+		}
+	}
+	if got := NewRetryPolicy(&config.Config{QueueMaxAttempts: 5}).MaxAttempts; got != 5 {
+		t.Errorf("NewRetryPolicy() MaxAttempts = %d, want 5", got)
+	}
+}
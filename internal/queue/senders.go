@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// mailer sends notification emails; email.EmailSender in production.
+type mailer interface {
+	SendNotificationEmail(notification models.Notification, language string) (bool, error)
+}
+
+// pusher sends push notifications; push.PushSender in production.
+type pusher interface {
+	SendNotification(subscription models.PushSubscription, title, message, url string) error
+}
+
+// directory looks up the users and push subscriptions notifications are
+// delivered to; database.MongoDB in production.
+type directory interface {
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	GetUsersWithNotificationsEnabled(ctx context.Context) ([]models.User, error)
+	GetUsersMentionedInComment(ctx context.Context, mentionedUsersIds string, recipientEmail string) ([]models.User, error)
+	GetAllPushSubscriptions(ctx context.Context) ([]models.PushSubscription, error)
+	GetPushSubscriptionsForUsers(ctx context.Context, userIDs []string) ([]models.PushSubscription, error)
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// ClaimOrder selects which due notification Claim returns.
+type ClaimOrder int
+
+const (
+	// ClaimByPriority returns the highest-priority notification, oldest first
+	// within the same priority.
+	ClaimByPriority ClaimOrder = iota
+	// ClaimOldestFirst ignores priorities and returns the oldest notification.
+	ClaimOldestFirst
+)
+
+// ErrLeaseLost is returned by Retry and Complete when the worker no longer
+// holds the lease on the notification, e.g. because it expired and another
+// worker claimed it.
+var ErrLeaseLost = errors.New("lease lost to another worker")
+
+// Store persists queued notifications. Workers claim notifications with a
+// lease; a notification whose lease expires before Complete is called becomes
+// claimable again, so work in flight during a crash is not lost. Completed
+// notifications are kept with their terminal status until they expire, so
+// their outcome can still be looked up.
+type Store interface {
+	// Add appends a pending notification to the queue.
+	Add(ctx context.Context, notification models.Notification) error
+	// AddMany appends several pending notifications atomically: either all of
+	// them are added or none are.
+	AddMany(ctx context.Context, notifications []models.Notification) error
+	// Claim leases the next due notification, chosen according to order, to
+	// owner and increments its attempt count, returning nil when nothing is
+	// due.
+	Claim(ctx context.Context, owner string, lease time.Duration, order ClaimOrder) (*models.Notification, error)
+	// Extend renews the lease held by owner on a claimed notification.
+	Extend(ctx context.Context, id string, owner string, lease time.Duration) error
+	// Retry releases a failed notification leased to owner, appends the
+	// failed attempt to its history and holds it back until nextAttemptAt. A
+	// non-nil report replaces the saved delivery report, so the next attempt
+	// knows who was already delivered to. An interrupted attempt is given
+	// back by decrementing the attempt count. It returns ErrLeaseLost if owner
+	// no longer holds the lease.
+	Retry(ctx context.Context, id string, owner string, nextAttemptAt time.Time, attempt models.Attempt, report *models.DeliveryReport) error
+	// Complete takes a notification leased to owner out of the queue with a
+	// terminal status and its delivery report, keeping it for lookups until
+	// expiresAt. It returns ErrLeaseLost if owner no longer holds the lease.
+	Complete(ctx context.Context, id string, owner string, status models.NotificationStatus, report *models.DeliveryReport, expiresAt time.Time) error
+	// Cancel marks a pending notification cancelled so it is never claimed,
+	// keeping it for lookups until expiresAt. It returns the cancelled
+	// notification, or nil when no pending notification has the given ID.
+	Cancel(ctx context.Context, id string, expiresAt time.Time) (*models.Notification, error)
+	// Get returns a notification in any status, or nil when it doesn't exist
+	// or has expired.
+	Get(ctx context.Context, id string) (*models.Notification, error)
+	// List returns up to filter.Limit notifications matching filter in
+	// enqueue order, starting after filter.After.
+	List(ctx context.Context, filter ListFilter) ([]models.Notification, error)
+	// Summarize counts the notifications matching filter by status and type,
+	// ignoring its cursor and limit.
+	Summarize(ctx context.Context, filter ListFilter) (Summary, error)
+	// Recover releases expired leases left behind by a previous run and
+	// returns how many notifications were put back to pending.
+	Recover(ctx context.Context) (int, error)
+}
+
+// DeadLetterStore keeps notifications that could not be delivered.
+type DeadLetterStore interface {
+	Add(ctx context.Context, deadLetter models.DeadLetter) error
+	List(ctx context.Context) ([]models.DeadLetter, error)
+	// Get returns nil when no dead letter has the given ID.
+	Get(ctx context.Context, id string) (*models.DeadLetter, error)
+	// Delete reports whether a dead letter with the given ID existed.
+	Delete(ctx context.Context, id string) (bool, error)
+	// Purge removes every dead letter and returns how many were removed.
+	Purge(ctx context.Context) (int, error)
+}
+
+// IdempotencyStore remembers which notification was created for each
+// idempotency key.
+type IdempotencyStore interface {
+	// Reserve stores record until its ExpiresAt. If its key is already held
+	// by an unexpired record, nothing is stored and that record is returned
+	// instead.
+	Reserve(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Release forgets key, e.g. when enqueuing its notification failed.
+	Release(ctx context.Context, key string) error
+}
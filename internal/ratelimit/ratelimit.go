@@ -0,0 +1,178 @@
+// Package ratelimit keeps callers from flooding the queue: token buckets
+// limit how fast each client enqueues notifications of each type, and depth
+// limits cap how many notifications may wait in the queue.
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// Limit applies to one notification type. Each client may enqueue Rate
+// notifications per second, in bursts of up to Burst, and at most MaxDepth
+// notifications of the type may be pending or processing. Zero disables a
+// limit.
+type Limit struct {
+	Rate     float64
+	Burst    int
+	MaxDepth int
+}
+
+// Limits are the limits of every notification type, plus MaxDepth for the
+// queue as a whole.
+type Limits struct {
+	MaxDepth int
+	Default  Limit
+	ByType   map[models.NotificationType]Limit
+}
+
+// typeLimit is an entry of NOTIFICATION_LIMITS; missing fields keep the
+// default.
+type typeLimit struct {
+	Rate     *float64 `json:"rate"`
+	Burst    *int     `json:"burst"`
+	MaxDepth *int     `json:"maxDepth"`
+}
+
+// LoadLimits reads RATE_LIMIT, RATE_LIMIT_BURST and QUEUE_MAX_DEPTH, and the
+// per-type overrides in NOTIFICATION_LIMITS, a JSON object such as
+// {"NEW_RECIPE": {"rate": 0.1, "burst": 5, "maxDepth": 100}}.
+func LoadLimits(cfg *config.Config) (Limits, error) {
+	limits := Limits{
+		MaxDepth: cfg.QueueMaxDepth,
+		Default:  Limit{Rate: cfg.RateLimit, Burst: cfg.RateLimitBurst},
+		ByType:   map[models.NotificationType]Limit{},
+	}
+	if cfg.NotificationLimits == "" {
+		return limits, nil
+	}
+
+	var overrides map[models.NotificationType]typeLimit
+	if err := json.Unmarshal([]byte(cfg.NotificationLimits), &overrides); err != nil {
+		return Limits{}, fmt.Errorf("parsing NOTIFICATION_LIMITS: %w", err)
+	}
+	for notificationType, override := range overrides {
+		if _, ok := models.SchemaFor(notificationType); !ok {
+			return Limits{}, fmt.Errorf("NOTIFICATION_LIMITS: unknown notification type %s", notificationType)
+		}
+		limit := limits.Default
+		if override.Rate != nil {
+			limit.Rate = *override.Rate
+		}
+		if override.Burst != nil {
+			limit.Burst = *override.Burst
+		}
+		if override.MaxDepth != nil {
+			limit.MaxDepth = *override.MaxDepth
+		}
+		limits.ByType[notificationType] = limit
+	}
+	return limits, nil
+}
+
+// For returns the limit of a notification type.
+func (l Limits) For(notificationType models.NotificationType) Limit {
+	if limit, ok := l.ByType[notificationType]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// idleBucketTTL is how often buckets that have refilled are dropped, so
+// clients that went away don't hold memory.
+const idleBucketTTL = time.Minute
+
+type bucketKey struct {
+	client           string
+	notificationType models.NotificationType
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Limiter holds a token bucket per client and notification type.
+type Limiter struct {
+	Limits Limits
+
+	mutex     sync.Mutex
+	buckets   map[bucketKey]*bucket
+	nextPrune time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		Limits:  limits,
+		buckets: map[bucketKey]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take charges client one token per notification in counts, by type. It
+// succeeds when every bucket involved holds at least one token; a batch may
+// then take more tokens than are left, and the debt holds back the client's
+// next requests. Otherwise nothing is charged and Take returns how long
+// until the emptiest bucket holds a token again.
+func (l *Limiter) Take(client string, counts map[models.NotificationType]int) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	var wait time.Duration
+	charged := map[*bucket]float64{}
+	for notificationType, count := range counts {
+		limit := l.Limits.For(notificationType)
+		if limit.Rate <= 0 {
+			continue
+		}
+		b := l.refill(bucketKey{client, notificationType}, limit, now)
+		if b.tokens < 1 {
+			seconds := (1 - b.tokens) / limit.Rate
+			wait = max(wait, time.Duration(math.Ceil(seconds*float64(time.Second))))
+		}
+		charged[b] = float64(count)
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for b, count := range charged {
+		b.tokens -= count
+	}
+	return 0, true
+}
+
+func (l *Limiter) refill(key bucketKey, limit Limit, now time.Time) *bucket {
+	burst := float64(max(limit.Burst, 1))
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updatedAt: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate)
+	b.updatedAt = now
+	return b
+}
+
+func (l *Limiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+	l.nextPrune = now.Add(idleBucketTTL)
+	for key, b := range l.buckets {
+		limit := l.Limits.For(key.notificationType)
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate >= float64(max(limit.Burst, 1)) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestLoadLimits(t *testing.T) {
+	limits, err := LoadLimits(&config.Config{
+		RateLimit:          10,
+		RateLimitBurst:     100,
+		QueueMaxDepth:      5000,
+		NotificationLimits: `{"NEW_RECIPE": {"rate": 0.5, "maxDepth": 50}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxDepth != 5000 {
+		t.Errorf("MaxDepth = %d, want 5000", limits.MaxDepth)
+	}
+	if got, want := limits.For(models.TypeNewRecipe), (Limit{Rate: 0.5, Burst: 100, MaxDepth: 50}); got != want {
+		t.Errorf("NEW_RECIPE limit = %+v, want %+v", got, want)
+	}
+	if got, want := limits.For(models.TypeNewLike), (Limit{Rate: 10, Burst: 100}); got != want {
+		t.Errorf("NEW_LIKE limit = %+v, want %+v", got, want)
+	}
+
+	for _, raw := range []string{`{`, `{"NOT_A_TYPE": {"rate": 1}}`} {
+		if _, err := LoadLimits(&config.Config{NotificationLimits: raw}); err == nil {
+			t.Errorf("LoadLimits(%s) succeeded", raw)
+		}
+	}
+}
+
+func TestLimiterTake(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewLimiter(Limits{
+		Default: Limit{Rate: 1, Burst: 2},
+		ByType:  map[models.NotificationType]Limit{models.TypeNewRecipe: {}},
+	})
+	limiter.now = func() time.Time { return now }
+	like := map[models.NotificationType]int{models.TypeNewLike: 1}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.Take("web", like); !ok {
+			t.Fatalf("request %d within the burst was limited", i+1)
+		}
+	}
+	wait, ok := limiter.Take("web", like)
+	if ok || wait != time.Second {
+		t.Fatalf("Take after the burst = %s, %t, want 1s, false", wait, ok)
+	}
+	if _, ok := limiter.Take("other", like); !ok {
+		t.Error("another client shares the bucket of web")
+	}
+	if _, ok := limiter.Take("web", map[models.NotificationType]int{models.TypeNewRecipe: 1000}); !ok {
+		t.Error("a type without a rate limit was limited")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := limiter.Take("web", like); !ok {
+		t.Error("the bucket did not refill")
+	}
+
+	// A batch may overdraw the bucket, and the debt holds back later
+	// requests.
+	now = now.Add(time.Minute)
+	if _, ok := limiter.Take("web", map[models.NotificationType]int{models.TypeNewLike: 5}); !ok {
+		t.Fatal("a batch larger than the tokens left was limited")
+	}
+	if wait, ok := limiter.Take("web", like); ok || wait != 4*time.Second {
+		t.Errorf("Take after overdrawing = %s, %t, want 4s, false", wait, ok)
+	}
+}
@@ -0,0 +1,155 @@
+// Package respond writes API responses. Requests routed under /v1/ get every
+// success wrapped in models.APIResponse and every error as an RFC 7807
+// problem; the unversioned routes keep their original bodies: raw JSON on
+// success and plain text errors.
+package respond
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+// Machine-readable error codes, returned in the code member of problems.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeMissingAPIKey       = "missing_api_key"
+	CodeInvalidAPIKey       = "invalid_api_key"
+	CodeExpiredAPIKey       = "expired_api_key"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeInvalidSignature    = "invalid_signature"
+	CodeReplayedRequest     = "replayed_request"
+	CodeInvalidToken        = "invalid_token"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeNotPending          = "not_pending"
+	CodeBatchTooLarge       = "batch_too_large"
+	CodeBodyTooLarge        = "body_too_large"
+	CodeRenderFailed        = "render_failed"
+	CodeIdempotencyConflict = "idempotency_conflict"
+	CodeRateLimited         = "rate_limited"
+	CodeQueueFull           = "queue_full"
+	CodeShuttingDown        = "shutting_down"
+	CodeInternal            = "internal_error"
+)
+
+// ProblemTypeBase is followed by the code of a problem to form its type,
+// which links to the documentation of that code.
+const ProblemTypeBase = "https://github.com/jorbush/jorbites-notifier/blob/main/docs/api.md#"
+
+const ContentTypeProblem = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object with a machine-readable code.
+type Problem struct {
+	Type     string                     `json:"type"`
+	Title    string                     `json:"title"`
+	Status   int                        `json:"status"`
+	Detail   string                     `json:"detail,omitempty"`
+	Instance string                     `json:"instance,omitempty"`
+	Code     string                     `json:"code"`
+	Problems []models.ValidationProblem `json:"problems,omitempty"`
+}
+
+type versionKey struct{}
+
+// V1 marks requests to next as made to the versioned API.
+func V1(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, 1)))
+	}
+}
+
+// IsV1 reports whether the request came through the versioned API.
+func IsV1(r *http.Request) bool {
+	return r.Context().Value(versionKey{}) == 1
+}
+
+// JSON writes v, wrapped in the envelope for the versioned API.
+func JSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if IsV1(r) {
+		Envelope(w, status, v)
+		return
+	}
+	write(w, "application/json", status, v)
+}
+
+// Envelope writes data wrapped in models.APIResponse on any route.
+func Envelope(w http.ResponseWriter, status int, data any) {
+	write(w, "application/json", status, models.APIResponse{Success: true, Data: data})
+}
+
+// Error answers with a problem on the versioned API and with message as plain
+// text otherwise.
+func Error(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	if !IsV1(r) {
+		http.Error(w, message, status)
+		return
+	}
+	writeProblem(w, r, Problem{Status: status, Code: code, Detail: message})
+}
+
+// MethodNotAllowed answers a request whose method the route doesn't support.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
+
+// InternalError answers a request that failed on the server side. The cause
+// is expected to be logged by the caller.
+func InternalError(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusInternalServerError, CodeInternal, "Internal Server Error")
+}
+
+// ValidationProblems answers 422 with every problem found in a notification.
+func ValidationProblems(w http.ResponseWriter, r *http.Request, problems []models.ValidationProblem) {
+	if !IsV1(r) {
+		write(w, "application/json", http.StatusUnprocessableEntity, map[string]any{
+			"error":    "Invalid notification",
+			"problems": problems,
+		})
+		return
+	}
+	writeProblem(w, r, Problem{
+		Status:   http.StatusUnprocessableEntity,
+		Code:     CodeValidationFailed,
+		Detail:   "Invalid notification",
+		Problems: problems,
+	})
+}
+
+// BodyTooLarge answers 413 if err comes from reading a request body past its
+// limit, and reports whether it did.
+func BodyTooLarge(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	Error(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit))
+	return true
+}
+
+// NotFound answers requests under /v1/ that match no route.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, CodeNotFound, "No route for "+r.URL.Path)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Type = ProblemTypeBase + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = r.URL.Path
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	write(w, ContentTypeProblem, problem.Status, problem)
+}
+
+func write(w http.ResponseWriter, contentType string, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
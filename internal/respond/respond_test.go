@@ -0,0 +1,92 @@
+package respond
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func serve(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestErrorKeepsPlainTextOnUnversionedRoutes(t *testing.T) {
+	rec := serve(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusNotFound, CodeNotFound, "Notification not found")
+	}, "/notifications/1")
+
+	if rec.Code != http.StatusNotFound || strings.TrimSpace(rec.Body.String()) != "Notification not found" {
+		t.Errorf("Error() = %d %q, want 404 with plain text", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+}
+
+func TestErrorWritesProblemOnV1(t *testing.T) {
+	rec := serve(V1(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusConflict, CodeNotPending, "Notification can't be cancelled: it is already sent")
+	}), "/v1/notifications/1")
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeProblem {
+		t.Errorf("Content-Type = %q, want %s", ct, ContentTypeProblem)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("problem body %q: %v", rec.Body.String(), err)
+	}
+	want := Problem{
+		Type:     "https://github.com/jorbush/jorbites-notifier/blob/main/docs/api.md#not_pending",
+		Title:    "Conflict",
+		Status:   http.StatusConflict,
+		Detail:   "Notification can't be cancelled: it is already sent",
+		Instance: "/v1/notifications/1",
+		Code:     CodeNotPending,
+	}
+	if rec.Code != http.StatusConflict || problem.Type != want.Type || problem.Title != want.Title ||
+		problem.Status != want.Status || problem.Detail != want.Detail || problem.Instance != want.Instance || problem.Code != want.Code {
+		t.Errorf("problem = %d %+v, want %+v", rec.Code, problem, want)
+	}
+}
+
+func TestValidationProblems(t *testing.T) {
+	problems := []models.ValidationProblem{{Field: "recipient", Message: "is required for NEW_LIKE"}}
+	handler := func(w http.ResponseWriter, r *http.Request) { ValidationProblems(w, r, problems) }
+
+	var legacy struct {
+		Error    string                     `json:"error"`
+		Problems []models.ValidationProblem `json:"problems"`
+	}
+	rec := serve(handler, "/notifications")
+	json.Unmarshal(rec.Body.Bytes(), &legacy)
+	if rec.Code != http.StatusUnprocessableEntity || legacy.Error != "Invalid notification" || len(legacy.Problems) != 1 {
+		t.Errorf("unversioned ValidationProblems() = %d %s", rec.Code, rec.Body.String())
+	}
+
+	var problem Problem
+	rec = serve(V1(handler), "/v1/notifications")
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	if rec.Code != http.StatusUnprocessableEntity || problem.Code != CodeValidationFailed || len(problem.Problems) != 1 {
+		t.Errorf("v1 ValidationProblems() = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJSONWrapsV1InEnvelope(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, r, http.StatusCreated, map[string]string{"id": "n1"})
+	}
+
+	if body := strings.TrimSpace(serve(handler, "/notifications").Body.String()); body != `{"id":"n1"}` {
+		t.Errorf("unversioned JSON() = %s, want the raw value", body)
+	}
+	rec := serve(V1(handler), "/v1/notifications")
+	if body := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusCreated || body != `{"success":true,"data":{"id":"n1"}}` {
+		t.Errorf("v1 JSON() = %d %s, want the value in the envelope", rec.Code, body)
+	}
+}
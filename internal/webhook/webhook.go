@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+const (
+	HeaderSignature = "X-Jorbites-Signature"
+	HeaderEvent     = "X-Jorbites-Event"
+	HeaderDelivery  = "X-Jorbites-Delivery"
+
+	EventNotificationCompleted = "notification.completed"
+)
+
+// Payload is the body of a delivery-result callback.
+type Payload struct {
+	Event          string                    `json:"event"`
+	NotificationID string                    `json:"notificationId"`
+	Type           models.NotificationType   `json:"type"`
+	Status         models.NotificationStatus `json:"status"`
+	Recipient      string                    `json:"recipient,omitempty"`
+	Attempts       int                       `json:"attempts"`
+	Error          string                    `json:"error,omitempty"`
+	Delivery       *Delivery                 `json:"delivery,omitempty"`
+	CompletedAt    time.Time                 `json:"completedAt"`
+}
+
+// Delivery counts the outcomes of a notification on each channel. Callbacks
+// leave out the per-recipient results, which hold users' email addresses.
+type Delivery struct {
+	Email models.ChannelSummary `json:"email"`
+	Push  models.ChannelSummary `json:"push"`
+}
+
+// Summarize returns the per-channel counts of report, or nil without one.
+func Summarize(report *models.DeliveryReport) *Delivery {
+	if report == nil {
+		return nil
+	}
+	return &Delivery{Email: report.Email, Push: report.Push}
+}
+
+// AllowList holds the hosts callbacks may be sent to: the host of
+// WEBHOOK_URL and those listed in WEBHOOK_ALLOWED_HOSTS. It keeps API
+// clients from pointing callbacks, and the service's requests, anywhere else.
+type AllowList struct {
+	hosts map[string]bool
+}
+
+func NewAllowList(cfg *config.Config) AllowList {
+	hosts := map[string]bool{}
+	if u, err := neturl.Parse(cfg.WebhookURL); err == nil && u.Host != "" {
+		hosts[strings.ToLower(u.Host)] = true
+	}
+	for _, host := range strings.Split(cfg.WebhookAllowedHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return AllowList{hosts: hosts}
+}
+
+// Allows reports whether url is an absolute http or https URL whose host,
+// including any port, is on the list.
+func (a AllowList) Allows(url string) bool {
+	u, err := neturl.Parse(url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return a.hosts[strings.ToLower(u.Host)]
+}
+
+// StatusError is returned when the receiver answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("callback answered %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Retryable reports whether the receiver may accept the callback later.
+// Other client errors mean the request itself was rejected.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Sender posts signed callbacks.
+type Sender struct {
+	secret string
+	client *http.Client
+}
+
+func NewSender(cfg *config.Config) *Sender {
+	return &Sender{
+		secret: cfg.WebhookSecret,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+	}
+}
+
+// Send posts payload to url, signed with the webhook secret. deliveryID stays
+// the same across retries so receivers can deduplicate.
+func (s *Sender) Send(ctx context.Context, url string, deliveryID string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "jorbites-notifier")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(s.secret, time.Now().Unix(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Sign returns the signature header for body sent at timestamp (Unix
+// seconds): "t=<timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">".
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// Verify checks a signature header produced by Sign, rejecting timestamps
+// more than tolerance away from now to prevent replays.
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, mac(secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+	if skew := now.Sub(time.Unix(t, 0)); skew > tolerance || skew < -tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func mac(secret string, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jorbush/jorbites-notifier/config"
+	"github.com/jorbush/jorbites-notifier/internal/models"
+)
+
+func TestSendSignsPayload(t *testing.T) {
+	var header string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(HeaderSignature)
+		body, _ = io.ReadAll(r.Body)
+		if r.Header.Get(HeaderDelivery) != "delivery-1" || r.Header.Get(HeaderEvent) != EventNotificationCompleted {
+			t.Errorf("headers = %v, want delivery and event headers", r.Header)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender := NewSender(&config.Config{WebhookSecret: "secret", WebhookTimeout: time.Second})
+	payload := Payload{Event: EventNotificationCompleted, NotificationID: "n1", Status: models.StatusSent}
+	if err := sender.Send(context.Background(), server.URL, "delivery-1", payload); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if err := Verify("secret", header, body, time.Now(), time.Minute); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := Verify("other", header, body, time.Now(), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with wrong secret error = %v, want ErrInvalidSignature", err)
+	}
+	if err := Verify("secret", header, append(body, ' '), time.Now(), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with tampered body error = %v, want ErrInvalidSignature", err)
+	}
+	if err := Verify("secret", header, body, time.Now().Add(time.Hour), time.Minute); !errors.Is(err, ErrExpiredSignature) {
+		t.Errorf("Verify() an hour later error = %v, want ErrExpiredSignature", err)
+	}
+}
+
+func TestSendReportsStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusGone, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadGateway, true},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		sender := NewSender(&config.Config{WebhookSecret: "secret", WebhookTimeout: time.Second})
+		err := sender.Send(context.Background(), server.URL, "delivery-1", Payload{})
+		server.Close()
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+			t.Fatalf("Send() to a %d receiver error = %v, want StatusError", tt.status, err)
+		}
+		if statusErr.Retryable() != tt.retryable {
+			t.Errorf("Retryable() for %d = %t, want %t", tt.status, statusErr.Retryable(), tt.retryable)
+		}
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	allowed := NewAllowList(&config.Config{
+		WebhookURL:          "https://jorbites.com/api/notifier",
+		WebhookAllowedHosts: "hooks.jorbites.com, Staging.Jorbites.com:8443",
+	})
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://jorbites.com/api/other", true},
+		{"https://hooks.jorbites.com/callback", true},
+		{"https://staging.jorbites.com:8443/callback", true},
+		{"https://staging.jorbites.com/callback", false},
+		{"https://evil.example/callback", false},
+		{"https://jorbites.com@evil.example/callback", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"ftp://jorbites.com/callback", false},
+		{"/relative", false},
+	}
+	for _, tt := range tests {
+		if got := allowed.Allows(tt.url); got != tt.want {
+			t.Errorf("Allows(%q) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+
+	if NewAllowList(&config.Config{}).Allows("https://jorbites.com/") {
+		t.Error("an empty allow list allowed a URL")
+	}
+}